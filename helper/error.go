@@ -0,0 +1,158 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/labstack/echo/v4"
+)
+
+// ServerError logs and responds to an unexpected error. Timeouts and
+// cancelled requests get their own status, so clients know they can retry.
+func ServerError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		Logger(c).Error("request timed out", slog.Any("error", err))
+		return c.JSON(http.StatusGatewayTimeout, ErrorRes(i18n.T(i18n.FromContext(c), "database timed out")))
+	case errors.Is(err, context.Canceled):
+		Logger(c).Warn("request cancelled", slog.Any("error", err))
+		return c.JSON(http.StatusServiceUnavailable, ErrorRes(i18n.T(i18n.FromContext(c), "request cancelled")))
+	}
+	Logger(c).Error("request failed", slog.Any("error", err))
+	return c.JSON(http.StatusInternalServerError, ErrorRes(i18n.T(i18n.FromContext(c), "Oops, something went wrong")))
+}
+
+// TooManyRequests responds 429 with a Retry-After header in whole seconds.
+func TooManyRequests(c echo.Context, message string, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	return ClientError(c, http.StatusTooManyRequests, message, nil)
+}
+
+// ErrorKind is what went wrong in a request, which decides its status.
+var ErrorKind = struct {
+	Validation   string
+	Unauthorized string
+	Forbidden    string
+	NotFound     string
+	Conflict     string
+	RateLimited  string
+}{
+	Validation:   "validation",
+	Unauthorized: "unauthorized",
+	Forbidden:    "forbidden",
+	NotFound:     "not_found",
+	Conflict:     "conflict",
+	RateLimited:  "rate_limited",
+}
+
+var errorStatus = map[string]int{
+	ErrorKind.Validation:   http.StatusBadRequest,
+	ErrorKind.Unauthorized: http.StatusUnauthorized,
+	ErrorKind.Forbidden:    http.StatusForbidden,
+	ErrorKind.NotFound:     http.StatusNotFound,
+	ErrorKind.Conflict:     http.StatusConflict,
+	ErrorKind.RateLimited:  http.StatusTooManyRequests,
+}
+
+// Error is returned by handlers for errors the client caused or can wait out.
+// Message is sent to the client and Err, the cause, is only logged.
+type Error struct {
+	Kind       string
+	Message    string
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Status() int {
+	return errorStatus[e.Kind]
+}
+
+func Invalid(message string, err error) error {
+	return &Error{Kind: ErrorKind.Validation, Message: message, Err: err}
+}
+
+func Unauthorized(message string, err error) error {
+	return &Error{Kind: ErrorKind.Unauthorized, Message: message, Err: err}
+}
+
+func Forbidden(message string, err error) error {
+	return &Error{Kind: ErrorKind.Forbidden, Message: message, Err: err}
+}
+
+func NotFound(message string, err error) error {
+	return &Error{Kind: ErrorKind.NotFound, Message: message, Err: err}
+}
+
+func Conflict(message string, err error) error {
+	return &Error{Kind: ErrorKind.Conflict, Message: message, Err: err}
+}
+
+func RateLimited(message string, retryAfter time.Duration) error {
+	return &Error{Kind: ErrorKind.RateLimited, Message: message, RetryAfter: retryAfter}
+}
+
+// StatusOf returns the status err is answered with by ErrorHandler.
+func StatusOf(err error) int {
+	var e *Error
+	var he *echo.HTTPError
+	switch {
+	case errors.As(err, &e):
+		return e.Status()
+	case errors.As(err, &he):
+		return he.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorHandler answers every error returned by handlers and middleware, so
+// they all share the ErrorResponse envelope, or a problem document for
+// validation errors. Any other error is a server error.
+func ErrorHandler(err error, c echo.Context) {
+	if err == nil || c.Response().Committed {
+		return
+	}
+
+	var e *Error
+	var he *echo.HTTPError
+	switch {
+	case errors.As(err, &e) && e.Kind == ErrorKind.Validation:
+		err = BadRequest(c, e.Message, e.Err)
+	case errors.As(err, &e) && e.Kind == ErrorKind.RateLimited:
+		err = TooManyRequests(c, e.Message, e.RetryAfter)
+	case errors.As(err, &e):
+		err = ClientError(c, e.Status(), e.Message, e.Err)
+	case errors.As(err, &he) && he.Code < http.StatusInternalServerError:
+		err = ClientError(c, he.Code, fmt.Sprint(he.Message), he.Internal)
+	case errors.As(err, &he):
+		Logger(c).Error("request failed", slog.Any("error", err))
+		err = c.JSON(he.Code, ErrorRes(i18n.T(i18n.FromContext(c), fmt.Sprint(he.Message))))
+	default:
+		err = ServerError(c, err)
+	}
+	if err != nil {
+		Logger(c).Error("failed to send error response", slog.Any("error", err))
+	}
+}
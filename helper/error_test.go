@@ -0,0 +1,107 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerError(t *testing.T) {
+	cases := map[string]struct {
+		err    error
+		status int
+	}{
+		"Timeout":   {fmt.Errorf("%w: canceling statement", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		"Cancelled": {context.Canceled, http.StatusServiceUnavailable},
+		"Other":     {errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+			ServerError(c, tc.err)
+
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+func TestClientErrorLocalized(t *testing.T) {
+	for lang, want := range map[string]string{
+		"th-TH": "ไม่พบการคำนวน",
+		"en":    "calculation not found",
+		"":      "calculation not found",
+	} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", lang)
+		rec := httptest.NewRecorder()
+
+		ClientError(e.NewContext(req, rec), http.StatusNotFound, "calculation not found", nil)
+
+		assert.JSONEq(t, `{"message": "`+want+`"}`, rec.Body.String(), lang)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	cases := map[string]struct {
+		err     error
+		status  int
+		message string
+	}{
+		"Validation":   {Invalid("invalid request", errors.New("bad json")), http.StatusBadRequest, "invalid request"},
+		"Unauthorized": {Unauthorized("unauthorized", nil), http.StatusUnauthorized, "unauthorized"},
+		"Forbidden":    {Forbidden("forbidden", nil), http.StatusForbidden, "forbidden"},
+		"Not found":    {NotFound("calculation not found", errors.New("no rows")), http.StatusNotFound, "calculation not found"},
+		"Conflict":     {Conflict("scheduled change is not pending", nil), http.StatusConflict, "scheduled change is not pending"},
+		"Rate limited": {RateLimited("rate limit exceeded", 1500*time.Millisecond), http.StatusTooManyRequests, "rate limit exceeded"},
+		"Wrapped":      {fmt.Errorf("err: lookup: %w", NotFound("calculation not found", nil)), http.StatusNotFound, "calculation not found"},
+		"Echo error":   {echo.ErrNotFound, http.StatusNotFound, "Not Found"},
+		"Timeout":      {fmt.Errorf("%w: canceling statement", context.DeadlineExceeded), http.StatusGatewayTimeout, "database timed out"},
+		"Unexpected":   {errors.New("connection refused"), http.StatusInternalServerError, "Oops, something went wrong"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+			ErrorHandler(tc.err, c)
+
+			var res ErrorResponse
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, tc.status, StatusOf(tc.err))
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, tc.message, res.Message)
+		})
+	}
+
+	t.Run("Rate limited should set Retry-After", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		ErrorHandler(RateLimited("rate limit exceeded", 1500*time.Millisecond), c)
+
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("Committed response should be left alone", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.String(http.StatusOK, "done")
+
+		ErrorHandler(errors.New("too late"), c)
+
+		assert.Equal(t, "done", rec.Body.String())
+	})
+}
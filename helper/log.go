@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var LogFormat = struct {
+	JSON string
+	Text string
+}{
+	JSON: "json",
+	Text: "text",
+}
+
+// NewLogger returns a logger writing to w at the given level (debug, info,
+// warn or error) in the given format (json or text).
+func NewLogger(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("err: invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	switch strings.ToLower(format) {
+	case LogFormat.JSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case LogFormat.Text:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("err: invalid log format %q", format)
+}
+
+// Logger returns the default logger with the request ID, route and trace ID of
+// the request, so every line logged while handling it can be found together.
+func Logger(c echo.Context) *slog.Logger {
+	l := slog.Default().With(
+		slog.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+		slog.String("method", c.Request().Method),
+		slog.String("route", c.Path()),
+	)
+	if span := trace.SpanContextFromContext(c.Request().Context()); span.HasTraceID() {
+		l = l.With(slog.String("trace_id", span.TraceID().String()))
+	}
+	return l
+}
+
+// ClientError responds with status and message, logging the error that
+// caused it. err may be nil when the request was rejected without one.
+func ClientError(c echo.Context, status int, message string, err error) error {
+	logRejected(c, status, message, err)
+	return c.JSON(status, ErrorRes(i18n.T(i18n.FromContext(c), message)))
+}
+
+func logRejected(c echo.Context, status int, message string, err error) {
+	args := []any{slog.Int("status", status), slog.String("message", message)}
+	if err != nil {
+		args = append(args, slog.Any("error", err))
+	}
+	Logger(c).Warn("request rejected", args...)
+}
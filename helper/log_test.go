@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("Level should filter lower levels", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := NewLogger(&buf, "warn", "json")
+
+		assert.NoError(t, err)
+		l.Info("hidden")
+		l.Warn("shown")
+		assert.NotContains(t, buf.String(), "hidden")
+		assert.Contains(t, buf.String(), "shown")
+	})
+
+	t.Run("Text format", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := NewLogger(&buf, "info", "text")
+
+		assert.NoError(t, err)
+		l.Info("hello", "key", "value")
+		assert.Contains(t, buf.String(), "msg=hello key=value")
+	})
+
+	t.Run("Invalid level should return error", func(t *testing.T) {
+		_, err := NewLogger(&bytes.Buffer{}, "verbose", "json")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid format should return error", func(t *testing.T) {
+		_, err := NewLogger(&bytes.Buffer{}, "info", "xml")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestErrorsShouldBeLogged(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := NewLogger(&buf, "info", "json")
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(l)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/tax/calculations", nil), rec)
+	c.SetPath("/tax/calculations")
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+	ServerError(c, errors.New("connection refused"))
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "ERROR", line["level"])
+	assert.Equal(t, "connection refused", line["error"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "/tax/calculations", line["route"])
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
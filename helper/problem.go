@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem document. Message repeats Detail for
+// clients reading the older {"message": ...} error responses.
+type Problem struct {
+	Type     string          `json:"type"`
+	Title    string          `json:"title"`
+	Status   int             `json:"status"`
+	Detail   string          `json:"detail,omitempty"`
+	Instance string          `json:"instance,omitempty"`
+	Errors   ValidationError `json:"errors,omitempty"`
+	Message  string          `json:"message,omitempty"`
+}
+
+// BadRequest responds 400 with a problem document, listing the invalid fields
+// when err is a ValidationError or a JSON value of the wrong type.
+func BadRequest(c echo.Context, detail string, err error) error {
+	lang := i18n.FromContext(c)
+	p := Problem{
+		Type:     "about:blank",
+		Title:    i18n.T(lang, http.StatusText(http.StatusBadRequest)),
+		Status:   http.StatusBadRequest,
+		Detail:   i18n.T(lang, detail),
+		Instance: c.Request().URL.Path,
+		Message:  i18n.T(lang, detail),
+	}
+	for _, f := range fieldErrors(err) {
+		p.Errors = append(p.Errors, f.Localize(lang))
+	}
+
+	logRejected(c, http.StatusBadRequest, detail, err)
+	c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+	return c.JSON(http.StatusBadRequest, p)
+}
+
+func fieldErrors(err error) ValidationError {
+	var verr ValidationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		t := jsonType(typeErr.Type)
+		return ValidationError{
+			NewFieldError(pointer("."+typeErr.Field), "type", t, "%s must be of type %s", typeErr.Field, t),
+		}
+	}
+	return nil
+}
+
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		if t == reflect.TypeOf(time.Time{}) {
+			return "string"
+		}
+		return "object"
+	}
+	return "string"
+}
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBadRequest(t *testing.T) {
+	e := echo.New()
+	newContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("Validation errors should be listed", func(t *testing.T) {
+		c, rec := newContext("")
+		verr := ValidationError{{Pointer: "/wht", Rule: "ltefield", Limit: 100.0, Message: "wht must be less than or equal to totalIncome"}}
+
+		BadRequest(c, "invalid request", verr)
+
+		var p Problem
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, "about:blank", p.Type)
+		assert.Equal(t, "Bad Request", p.Title)
+		assert.Equal(t, "/tax/calculations", p.Instance)
+		assert.Equal(t, "invalid request", p.Message)
+		assert.Equal(t, "/wht", p.Errors[0].Pointer)
+		assert.Equal(t, 100.0, p.Errors[0].Limit)
+	})
+
+	t.Run("JSON type errors should be listed", func(t *testing.T) {
+		c, rec := newContext(`{"totalIncome": "a lot"}`)
+		var body struct {
+			TotalIncome float64 `json:"totalIncome"`
+		}
+
+		BadRequest(c, "invalid request", c.Bind(&body))
+
+		var p Problem
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, ValidationError{{
+			Pointer: "/totalIncome", Rule: "type", Limit: "number",
+			Message: "totalIncome must be of type number",
+		}}, p.Errors)
+	})
+
+	t.Run("Other errors should only have a detail", func(t *testing.T) {
+		c, rec := newContext("")
+
+		BadRequest(c, "invalid request", errors.New("boom"))
+
+		var p Problem
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, "invalid request", p.Detail)
+		assert.Empty(t, p.Errors)
+	})
+}
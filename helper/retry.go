@@ -0,0 +1,29 @@
+package helper
+
+import (
+	"log/slog"
+	"time"
+)
+
+// sleep is replaced in tests.
+var sleep = time.Sleep
+
+// Retry calls fn up to attempts times until it succeeds, waiting backoff
+// after the first failure and doubling the wait after each one, up to max.
+func Retry(attempts int, backoff time.Duration, max time.Duration, fn func() error) error {
+	var err error
+	for i := 1; ; i++ {
+		if err = fn(); err == nil || i >= attempts {
+			return err
+		}
+
+		slog.Warn("attempt failed, retrying",
+			slog.Int("attempt", i),
+			slog.Int("attempts", attempts),
+			slog.Duration("backoff", backoff),
+			slog.Any("error", err),
+		)
+		sleep(backoff)
+		backoff = min(backoff*2, max)
+	}
+}
@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	t.Run("Should stop after success", func(t *testing.T) {
+		waits = nil
+		calls := 0
+
+		err := Retry(5, time.Second, 3*time.Second, func() error {
+			calls++
+			if calls < 4 {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 4, calls)
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, waits)
+	})
+
+	t.Run("Should return the last error", func(t *testing.T) {
+		waits = nil
+		calls := 0
+
+		err := Retry(3, time.Second, time.Minute, func() error {
+			calls++
+			return errors.New("connection refused")
+		})
+
+		assert.EqualError(t, err, "connection refused")
+		assert.Equal(t, 3, calls)
+		assert.Len(t, waits, 2)
+	})
+}
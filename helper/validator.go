@@ -2,21 +2,214 @@ package helper
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
 )
 
 type CustomValidator struct {
 	validator *validator.Validate
 }
 
+// Validate returns a ValidationError listing every invalid field of i, named
+// by its JSON pointer.
 func (cv *CustomValidator) Validate(i interface{}) error {
-	if err := cv.validator.Struct(i); err != nil {
-		return errors.New("invalid request")
+	err := cv.validator.Struct(i)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
 	}
-	return nil
+
+	root := reflect.ValueOf(i)
+	verr := ValidationError{}
+	for _, fe := range errs {
+		verr = append(verr, fieldError(root, fe))
+	}
+	return verr
 }
 
 func NewValidator() *CustomValidator {
-	return &CustomValidator{validator: validator.New(validator.WithRequiredStructEnabled())}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string { return jsonName(f) })
+	return &CustomValidator{validator: v}
+}
+
+// FieldError is one invalid field: where it is, the rule it broke, the limit
+// of that rule when it has one, and a message for people.
+type FieldError struct {
+	Pointer string      `json:"pointer"`
+	Rule    string      `json:"rule"`
+	Limit   interface{} `json:"limit,omitempty"`
+	Message string      `json:"message"`
+
+	// format and args render Message again in the language of the request.
+	format string
+	args   []any
+}
+
+// NewFieldError returns a field error with its message formatted in English,
+// to be translated when it is sent.
+func NewFieldError(pointer string, rule string, limit interface{}, format string, args ...any) FieldError {
+	return FieldError{
+		Pointer: pointer,
+		Rule:    rule,
+		Limit:   limit,
+		Message: fmt.Sprintf(format, args...),
+		format:  format,
+		args:    args,
+	}
+}
+
+// Localize returns the error with its message in lang.
+func (f FieldError) Localize(lang string) FieldError {
+	if f.format != "" {
+		f.Message = i18n.T(lang, f.format, f.args...)
+	}
+	return f
+}
+
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := []string{}
+	for _, f := range e {
+		messages = append(messages, f.Pointer+": "+f.Message)
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// At returns the errors with prefix added to their pointers, for a value
+// validated as part of a larger document.
+func (e ValidationError) At(prefix string) ValidationError {
+	at := ValidationError{}
+	for _, f := range e {
+		f.Pointer = prefix + f.Pointer
+		at = append(at, f)
+	}
+	return at
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+func fieldError(root reflect.Value, fe validator.FieldError) FieldError {
+	pointer, rule := pointer(fe.Namespace()), fe.Tag()
+	name, param := fe.Field(), fe.Param()
+
+	switch rule {
+	case "required":
+		return NewFieldError(pointer, rule, nil, "%s is required", name)
+	case "gt", "gte", "lt", "lte":
+		return NewFieldError(pointer, rule, number(param), comparisons[rule], name, param)
+	case "gtfield", "gtefield", "ltfield", "ltefield", "eqfield", "nefield":
+		var limit interface{}
+		other := parent(root, fe.StructNamespace())
+		if other.IsValid() {
+			if sf, ok := other.Type().FieldByName(param); ok {
+				param = jsonName(sf)
+				limit = value(other.FieldByIndex(sf.Index))
+			}
+		}
+		return NewFieldError(pointer, rule, limit, comparisons[strings.TrimSuffix(rule, "field")], name, param)
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return NewFieldError(pointer, rule, number(param), "%s must contain at least %s items", name, param)
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		return NewFieldError(pointer, rule, options, "%s must be one of %s", name, strings.Join(options, ", "))
+	case "unique":
+		t := fe.Type()
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if sf, ok := t.FieldByName(param); ok && t.Kind() == reflect.Struct {
+			param = jsonName(sf)
+		}
+		return NewFieldError(pointer, rule, nil, "%s must not contain duplicate %s", name, param)
+	case "excluded_with":
+		return NewFieldError(pointer, rule, nil, "%s must not be set together with %s", name, param)
+	case "numeric":
+		return NewFieldError(pointer, rule, nil, "%s must be a number", name)
+	}
+
+	var limit interface{}
+	if param != "" {
+		limit = param
+	}
+	return NewFieldError(pointer, rule, limit, "%s is invalid", name)
+}
+
+var comparisons = map[string]string{
+	"gt":  "%s must be greater than %s",
+	"gte": "%s must be greater than or equal to %s",
+	"lt":  "%s must be less than %s",
+	"lte": "%s must be less than or equal to %s",
+	"eq":  "%s must be equal to %s",
+	"ne":  "%s must be different from %s",
+}
+
+// pointer turns a validator namespace such as Body.allowances[1].amount into
+// the JSON pointer /allowances/1/amount.
+func pointer(namespace string) string {
+	_, path, _ := strings.Cut(namespace, ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var b strings.Builder
+	for _, segment := range strings.Split(path, ".") {
+		b.WriteString("/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(segment))
+	}
+	return b.String()
+}
+
+// parent returns the struct holding the field at structNamespace, or an
+// invalid value when it cannot be found.
+func parent(root reflect.Value, structNamespace string) reflect.Value {
+	segments := strings.Split(structNamespace, ".")
+	v := reflect.Indirect(root)
+	for _, s := range segments[1 : len(segments)-1] {
+		name, index, indexed := strings.Cut(s, "[")
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		v = reflect.Indirect(v.FieldByName(name))
+		if indexed {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || i >= v.Len() {
+				return reflect.Value{}
+			}
+			v = reflect.Indirect(v.Index(i))
+		}
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return v
+}
+
+func value(v reflect.Value) interface{} {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func number(s string) interface{} {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n
+	}
+	return s
 }
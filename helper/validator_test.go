@@ -35,3 +35,68 @@ func TestValidate(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestValidateFieldErrors(t *testing.T) {
+	type item struct {
+		Type   string  `json:"type" validate:"required,oneof=a b"`
+		Amount float64 `json:"amount" validate:"gte=0"`
+	}
+	type body struct {
+		Total float64 `json:"total" validate:"required,gte=0"`
+		Part  float64 `json:"part" validate:"ltefield=Total"`
+		Items []item  `json:"items" validate:"unique=Type,dive"`
+	}
+	cv := NewValidator()
+	validate := func(i interface{}) ValidationError {
+		verr := cv.Validate(i).(ValidationError)
+		for i := range verr {
+			verr[i].format, verr[i].args = "", nil
+		}
+		return verr
+	}
+
+	t.Run("Field compared with another field", func(t *testing.T) {
+		err := validate(body{Total: 100, Part: 200})
+
+		assert.Equal(t, ValidationError{{
+			Pointer: "/part", Rule: "ltefield", Limit: 100.0,
+			Message: "part must be less than or equal to total",
+		}}, err)
+	})
+
+	t.Run("Too few items", func(t *testing.T) {
+		type list struct {
+			Items []item `json:"items" validate:"required,min=1"`
+		}
+		err := validate(list{Items: []item{}})
+
+		assert.Equal(t, ValidationError{{
+			Pointer: "/items", Rule: "min", Limit: 1.0,
+			Message: "items must contain at least 1 items",
+		}}, err)
+	})
+
+	t.Run("Duplicate items", func(t *testing.T) {
+		err := validate(body{Total: 100, Items: []item{{Type: "a"}, {Type: "a"}}})
+
+		assert.Equal(t, ValidationError{{
+			Pointer: "/items", Rule: "unique",
+			Message: "items must not contain duplicate type",
+		}}, err)
+	})
+
+	t.Run("Nested fields", func(t *testing.T) {
+		err := validate(body{Total: 100, Items: []item{{Type: "a"}, {Type: "c", Amount: -1}}})
+
+		assert.Equal(t, ValidationError{
+			{Pointer: "/items/1/type", Rule: "oneof", Limit: []string{"a", "b"}, Message: "type must be one of a, b"},
+			{Pointer: "/items/1/amount", Rule: "gte", Limit: 0.0, Message: "amount must be greater than or equal to 0"},
+		}, err)
+	})
+
+	t.Run("Errors at a prefix", func(t *testing.T) {
+		err := validate(body{})
+
+		assert.Equal(t, "/2/total", err.At("/2")[0].Pointer)
+	})
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
 	"github.com/jaiieth/assessment-tax/middleware"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
 	"github.com/jaiieth/assessment-tax/pkg/calculator"
 	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/health"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/jaiieth/assessment-tax/pkg/tracing"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 )
@@ -21,43 +29,190 @@ func main() {
 	//Load env
 	godotenv.Load()
 
+	logger, err := helper.NewLogger(os.Stdout, env("LOG_LEVEL", "info"), env("LOG_FORMAT", helper.LogFormat.JSON))
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), env("OTEL_TRACES_EXPORTER", tracing.Exporter.None), health.Version)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		if err := runUsers(os.Args[2:], os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	//Init DB
-	db, err := config.New()
+	db, err := config.Open()
+	if err != nil {
+		panic(fmt.Sprintf("failed to connect database: %v", err))
+	}
+
+	var sqlDB *sql.DB
+	postgres, isPostgres := db.(*config.Postgres)
+	if isPostgres {
+		sqlDB = postgres.Db
+	}
+
+	h := health.NewHandler(sqlDB)
+	if isPostgres {
+		h.Checks["migrations"] = postgres.Migrated
+	}
+	store := db
+	h.Checks["config"] = func(ctx context.Context) error {
+		_, err := store.GetConfig(ctx)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db = config.NewInstrumented(db)
+	ttl, err := time.ParseDuration(env("CONFIG_CACHE_TTL", "1m"))
 	if err != nil {
-		panic("failed to connect database")
+		panic(fmt.Sprintf("invalid CONFIG_CACHE_TTL: %v", err))
+	}
+	if ttl > 0 {
+		cache := config.NewCache(db, ttl)
+		if sqlDB != nil {
+			go func() {
+				if err := config.Listen(ctx, cache.Invalidate); err != nil {
+					slog.Error("config change listener stopped, relying on CONFIG_CACHE_TTL", slog.Any("error", err))
+				}
+			}()
+		}
+		db = cache
 	}
 
+	interval, err := time.ParseDuration(env("CONFIG_SCHEDULE_INTERVAL", "10s"))
+	if err != nil || interval <= 0 {
+		panic(fmt.Sprintf("invalid CONFIG_SCHEDULE_INTERVAL: %q", os.Getenv("CONFIG_SCHEDULE_INTERVAL")))
+	}
+	go config.RunSchedule(ctx, db, interval)
+
 	//Init Echo
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
 	port := os.Getenv("PORT")
 
+	e.Use(middleware.RequestID)
+	e.Use(middleware.Tracing)
 	e.Use(middleware.Logger)
+	e.Use(middleware.Metrics)
+	e.Use(middleware.Locale)
 	e.Validator = helper.NewValidator()
+	e.HTTPErrorHandler = helper.ErrorHandler
+	// Client IPs decide login lockouts, so X-Forwarded-For is only trusted
+	// when running behind a proxy.
+	e.IPExtractor = echo.ExtractIPDirect()
+	if os.Getenv("TRUST_PROXY") == "true" {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
 
-	admin := e.Group("/admin", middleware.Auth)
+	users := auth.NewUserStore(sqlDB)
+	if err := auth.Seed(ctx, users, os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		panic(err)
+	}
+	tokens, generated, err := auth.TokensFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	if generated {
+		slog.Warn("AUTH_TOKEN_SECRET is not set, tokens will not survive a restart")
+	}
+
+	lockout := auth.NewLockout(auth.NewAuditStore(sqlDB))
+
+	var queryTimeout time.Duration
+	if isPostgres {
+		queryTimeout = postgres.Timeout
+	}
+	history, err := calculator.NewHistoryRepository(sqlDB, queryTimeout)
+	if err != nil {
+		panic(err)
+	}
+
+	anonymous, err := apikey.AnonymousFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	keys := apikey.NewStore(sqlDB)
+	keyTTL, err := time.ParseDuration(env("API_KEY_CACHE_TTL", apikey.DEFAULT_CACHE_TTL.String()))
+	if err != nil {
+		panic(fmt.Sprintf("invalid API_KEY_CACHE_TTL: %v", err))
+	}
+	if keyTTL > 0 {
+		keys = apikey.NewCache(keys, keyTTL)
+	}
+	limiter := apikey.NewLimiter()
 
 	c := calculator.NewHandler(db)
-	a := config.NewHandler(db)
+	c.History = history
+	c.Limiter = limiter
 
-	c.RegisterRoutes(e)
-	a.RegisterRoutes(admin)
+	spec, err := openapi.NewValidator(openapi.Spec)
+	if err != nil {
+		panic(err)
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	routes{
+		calculator: c,
+		health:     h,
+		auth:       auth.NewHandler(users, tokens, lockout),
+		config:     config.NewHandler(db),
+		apiKeys:    apikey.NewHandler(keys),
+		apiKey:     middleware.APIKey(keys, limiter, anonymous),
+		adminAuth:  middleware.Auth(users, tokens, lockout),
+		validate:   middleware.Validate(spec, os.Getenv("OPENAPI_VALIDATE_RESPONSES") == "true"),
+	}.register(e)
 
+	slog.Info("starting server", slog.String("port", port))
 	go func() {
 		if err := e.Start(fmt.Sprintf(":%v", port)); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
+			slog.Error("server stopped unexpectedly", slog.Any("error", err))
+			os.Exit(1)
 		}
 	}()
 
 	<-ctx.Done()
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
+
+	// Fail readiness first and give load balancers time to notice before
+	// connections are refused.
+	h.Drain()
+	delay, err := time.ParseDuration(env("SHUTDOWN_DELAY", "5s"))
+	if err != nil {
+		slog.Error("invalid SHUTDOWN_DELAY", slog.Any("error", err))
+	}
+	time.Sleep(delay)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(fmt.Sprintf("err: failed to shutdown server %v", err))
+		slog.Error("failed to shutdown server", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", slog.Any("error", err))
+	}
+	slog.Info("server stopped")
+}
+
+func env(key string, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
 	}
-	log.Println("Server stopped")
+	return fallback
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderAPIKey = "X-API-Key"
+
+// ClientKey is the context key holding the apikey.Key of the client.
+const ClientKey = "apiKey"
+
+// APIKey identifies the client application by the X-API-Key header and
+// applies its rate limit. Requests without a key share the anonymous key, or
+// are rejected when anonymous is nil.
+func APIKey(keys apikey.Store, limiter *apikey.Limiter, anonymous *apikey.Key) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var k apikey.Key
+			secret := c.Request().Header.Get(HeaderAPIKey)
+			switch {
+			case secret != "":
+				var err error
+				k, err = apikey.Lookup(c.Request().Context(), keys, secret)
+				if errors.Is(err, apikey.ErrKeyNotFound) || errors.Is(err, apikey.ErrKeyRevoked) {
+					return helper.Unauthorized("invalid api key", err)
+				}
+				if err != nil {
+					return err
+				}
+			case anonymous != nil:
+				k = *anonymous
+			default:
+				return helper.Unauthorized("api key required", nil)
+			}
+
+			if ok, retryAfter := limiter.Allow(k); !ok {
+				return helper.RateLimited("rate limit exceeded", retryAfter)
+			}
+
+			c.Set(ClientKey, k)
+			return next(c)
+		}
+	}
+}
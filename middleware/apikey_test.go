@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	keys := apikey.NewMemory()
+	k, _ := apikey.NewKey("mobile app", 1, 0)
+	k, _ = keys.CreateKey(context.Background(), k)
+	revoked, _ := apikey.NewKey("old app", 60, 0)
+	revoked, _ = keys.CreateKey(context.Background(), revoked)
+	keys.RevokeKey(context.Background(), revoked.ID)
+
+	newServer := func(anonymous *apikey.Key) *echo.Echo {
+		e := echo.New()
+		e.HTTPErrorHandler = helper.ErrorHandler
+		e.POST("/tax/calculations", func(c echo.Context) error {
+			return c.String(http.StatusOK, c.Get(ClientKey).(apikey.Key).Name)
+		}, APIKey(keys, apikey.NewLimiter(), anonymous))
+		return e
+	}
+	request := func(e *echo.Echo, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", nil)
+		if secret != "" {
+			req.Header.Set(HeaderAPIKey, secret)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Valid key should be allowed", func(t *testing.T) {
+		rec := request(newServer(nil), k.Secret)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "mobile app", rec.Body.String())
+	})
+
+	t.Run("Revoked or unknown key should return 401", func(t *testing.T) {
+		e := newServer(nil)
+
+		assert.Equal(t, http.StatusUnauthorized, request(e, revoked.Secret).Code)
+		assert.Equal(t, http.StatusUnauthorized, request(e, "ktx_unknown").Code)
+	})
+
+	t.Run("No key should use the anonymous key", func(t *testing.T) {
+		rec := request(newServer(&apikey.Key{Name: "anonymous", RateLimit: 60}), "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "anonymous", rec.Body.String())
+	})
+
+	t.Run("No key without anonymous access should return 401", func(t *testing.T) {
+		rec := request(newServer(nil), "")
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Request over the rate limit should return 429", func(t *testing.T) {
+		e := newServer(nil)
+		request(e, k.Secret)
+
+		rec := request(e, k.Secret)
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	})
+}
@@ -1,20 +1,68 @@
 package middleware
 
 import (
-	"os"
+	"errors"
+	"strings"
 
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 )
 
-var Auth = middleware.BasicAuth(checkAuth)
+// UsernameKey is the context key holding the authenticated admin username.
+const UsernameKey = "username"
 
-func checkAuth(u, p string, c echo.Context) (bool, error) {
-	au := os.Getenv("ADMIN_USERNAME")
-	ap := os.Getenv("ADMIN_PASSWORD")
+// RoleKey is the context key holding the role of the authenticated admin.
+const RoleKey = "role"
 
-	if au == "" || ap == "" {
-		return false, echo.ErrInternalServerError
+// Auth authenticates admin requests with a bearer token from the login
+// endpoint, or with Basic credentials checked against the same users, and
+// rejects requests the user's current role does not allow. Basic credentials are
+// subject to the same lockout as the login endpoint.
+func Auth(users auth.UserStore, tokens auth.Tokens, lockout *auth.Lockout) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			username, role, err := authenticate(c, users, tokens, lockout)
+			if errors.Is(err, auth.ErrLockedOut) {
+				return helper.RateLimited(err.Error(), lockout.Locked(username, c.RealIP()))
+			}
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrInvalidCredentials) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+				return helper.Unauthorized("unauthorized", err)
+			}
+			if err != nil {
+				return err
+			}
+
+			if !auth.Allows(role, c.Request().Method) {
+				return helper.Forbidden("forbidden", nil)
+			}
+
+			c.Set(UsernameKey, username)
+			c.Set(RoleKey, role)
+			return next(c)
+		}
 	}
-	return u == au && p == ap, nil
+}
+
+func authenticate(c echo.Context, users auth.UserStore, tokens auth.Tokens, lockout *auth.Lockout) (username string, role string, err error) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		user, err := tokens.VerifyUser(c.Request().Context(), users, token)
+		if err != nil {
+			return "", "", err
+		}
+		return user.Username, user.Role, nil
+	}
+
+	if u, p, ok := c.Request().BasicAuth(); ok {
+		user, err := lockout.Login(c, users, u, p)
+		if err != nil {
+			return u, "", err
+		}
+		return user.Username, user.Role, nil
+	}
+
+	return "", "", auth.ErrInvalidCredentials
 }
@@ -1,71 +1,237 @@
 package middleware
 
 import (
-	"encoding/base64"
-	"fmt"
+	"bytes"
+	"context"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCheckAuth(t *testing.T) {
-	t.Run("Invalid ENV", func(t *testing.T) {
-		e := echo.New()
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
+func TestAuth(t *testing.T) {
+	users := auth.NewMemoryUsers()
+	for username, role := range map[string]string{"adminTax": auth.Role.Editor, "viewer": auth.Role.Viewer} {
+		u, _ := auth.NewUser(username, "password", role)
+		users.CreateUser(context.Background(), u)
+	}
+	tokens := auth.Tokens{Secret: []byte("secret"), TTL: time.Hour}
+
+	e := echo.New()
+
+	e.HTTPErrorHandler = helper.ErrorHandler
+	admin := e.Group("/admin", Auth(users, tokens, auth.NewLockout(auth.NewAuditStore(nil))))
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get(UsernameKey).(string)+" "+c.Get(RoleKey).(string))
+	}
+	admin.GET("/config", handler)
+	admin.POST("/deductions/:type", handler)
+
+	request := func(method string, target string, setAuth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		setAuth(req)
 		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(username string, role string) func(*http.Request) {
+		token, _ := tokens.Issue(auth.User{Username: username, Role: role})
+		return func(r *http.Request) { r.Header.Set(echo.HeaderAuthorization, "Bearer "+token.Token) }
+	}
+	basic := func(username string, password string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(username, password) }
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		rec := request(http.MethodPost, "/admin/deductions/personal", bearer("adminTax", auth.Role.Editor))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "adminTax editor", rec.Body.String())
+	})
 
-		data := "admin:password"
-		encoded := base64.StdEncoding.EncodeToString([]byte(data))
+	t.Run("Valid Basic credentials", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/config", basic("adminTax", "password"))
 
-		req.Header.Set("Authorization", "Basic "+encoded)
-		c := e.NewContext(req, rec)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "adminTax editor", rec.Body.String())
+	})
 
-		isValid, err := checkAuth("admin", "password", c)
+	t.Run("Invalid credentials", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/config", basic("adminTax", "wrong password"))
 
-		assert.Error(t, err)
-		assert.False(t, isValid)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	})
 
-	os.Setenv("ADMIN_USERNAME", "admin")
-	os.Setenv("ADMIN_PASSWORD", "password")
+	t.Run("Token signed with another secret", func(t *testing.T) {
+		other := auth.Tokens{Secret: []byte("other"), TTL: time.Hour}
+		token, _ := other.Issue(auth.User{Username: "adminTax", Role: auth.Role.Editor})
 
-	t.Run("Valid credentials", func(t *testing.T) {
-		e := echo.New()
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
-		rec := httptest.NewRecorder()
+		rec := request(http.MethodGet, "/admin/config", func(r *http.Request) {
+			r.Header.Set(echo.HeaderAuthorization, "Bearer "+token.Token)
+		})
 
-		data := "admin:password"
-		encoded := base64.StdEncoding.EncodeToString([]byte(data))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
 
-		req.Header.Set("Authorization", "Basic "+encoded)
-		c := e.NewContext(req, rec)
+	t.Run("Token should get the current role of the user", func(t *testing.T) {
+		rec := request(http.MethodPost, "/admin/deductions/personal", bearer("viewer", auth.Role.Editor))
 
-		isValid, err := checkAuth("admin", "password", c)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
 
-		assert.NoError(t, err)
-		assert.True(t, isValid)
+	t.Run("Token of an unknown user", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/config", bearer("removed", auth.Role.Editor))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	})
 
-	t.Run("Invalid credentials", func(t *testing.T) {
+	t.Run("Missing credentials", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/config", func(*http.Request) {})
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	})
+
+	t.Run("Viewer should read the config", func(t *testing.T) {
+		rec := request(http.MethodGet, "/admin/config", bearer("viewer", auth.Role.Viewer))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Viewer should not change deductions", func(t *testing.T) {
+		rec := request(http.MethodPost, "/admin/deductions/personal", basic("viewer", "password"))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestAuthLockout(t *testing.T) {
+	users := auth.NewMemoryUsers()
+	for _, username := range []string{"adminTax", "other"} {
+		u, _ := auth.NewUser(username, "password", auth.Role.Editor)
+		users.CreateUser(context.Background(), u)
+	}
+	tokens := auth.Tokens{Secret: []byte("secret"), TTL: time.Hour}
+
+	var audit *auth.MemoryAudit
+	newServer := func() *echo.Echo {
+		audit = &auth.MemoryAudit{}
 		e := echo.New()
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		e.HTTPErrorHandler = helper.ErrorHandler
+		e.IPExtractor = echo.ExtractIPDirect()
+		e.GET("/admin/config", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}, Auth(users, tokens, auth.NewLockout(audit)))
+		return e
+	}
+	request := func(e *echo.Echo, ip string, username string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.SetBasicAuth(username, password)
 		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
 
-		username := os.Getenv("ADMIN_USERNAME")
-		password := os.Getenv("ADMIN_PASSWORD")
-		data := fmt.Sprintf("%s:%s", username, password)
-		encoded := base64.StdEncoding.EncodeToString([]byte(data))
+	t.Run("Guessing one password should lock the user out", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS; i++ {
+			assert.Equal(t, http.StatusUnauthorized, request(e, "10.0.0.1", "adminTax", "guess").Code)
+		}
+
+		rec := request(e, "10.0.0.1", "adminTax", "password")
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("Guessing from many IPs should lock the user out", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS; i++ {
+			request(e, "10.0.0."+strconv.Itoa(i), "adminTax", "guess")
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, request(e, "10.0.1.1", "adminTax", "password").Code)
+		assert.Equal(t, http.StatusOK, request(e, "10.0.1.1", "other", "password").Code)
+	})
+
+	t.Run("Guessing many users from one IP should lock the IP out", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS; i++ {
+			request(e, "10.0.0.1", "user"+strconv.Itoa(i), "guess")
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, request(e, "10.0.0.1", "other", "password").Code)
+		assert.Equal(t, http.StatusOK, request(e, "10.0.0.2", "other", "password").Code)
+	})
+
+	t.Run("Spoofed X-Forwarded-For should not avoid the IP lockout", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set(echo.HeaderXForwardedFor, "192.168.0."+strconv.Itoa(i))
+			req.SetBasicAuth("user"+strconv.Itoa(i), "guess")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, request(e, "10.0.0.1", "other", "password").Code)
+	})
+
+	t.Run("Successful login should reset the failures", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS-1; i++ {
+			request(e, "10.0.0.1", "adminTax", "guess")
+		}
+		assert.Equal(t, http.StatusOK, request(e, "10.0.0.1", "adminTax", "password").Code)
+
+		assert.Equal(t, http.StatusUnauthorized, request(e, "10.0.0.1", "adminTax", "guess").Code)
+	})
+
+	t.Run("Logging in to an owned account should not reset the IP failures", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS-1; i++ {
+			request(e, "10.0.0.1", "user"+strconv.Itoa(i), "guess")
+		}
+		assert.Equal(t, http.StatusOK, request(e, "10.0.0.1", "other", "password").Code)
+		request(e, "10.0.0.1", "adminTax", "guess")
+
+		assert.Equal(t, http.StatusTooManyRequests, request(e, "10.0.0.1", "other", "password").Code)
+	})
+
+	t.Run("Failures should be written to the audit store", func(t *testing.T) {
+		e := newServer()
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS+1; i++ {
+			request(e, "10.0.0.1", "adminTax", "guess")
+		}
+
+		entries := audit.Entries()
+		assert.Len(t, entries, auth.MAX_FAILED_ATTEMPTS+1)
+		assert.Equal(t, auth.AuthEvent.Failed, entries[0].Event)
+		assert.Equal(t, "adminTax", entries[0].Username)
+		assert.Equal(t, "10.0.0.1", entries[0].RemoteIP)
+		assert.Equal(t, 1, entries[0].Attempts)
+		assert.Equal(t, auth.LOCKOUT_BASE, entries[auth.MAX_FAILED_ATTEMPTS-1].LockedFor)
+		assert.Equal(t, auth.AuthEvent.LockedOut, entries[auth.MAX_FAILED_ATTEMPTS].Event)
+	})
 
-		req.Header.Set("Authorization", "Basic "+encoded)
-		c := e.NewContext(req, rec)
+	t.Run("Failures should be logged for auditing", func(t *testing.T) {
+		var buf bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
 
-		isValid, err := checkAuth(username, "wrong password", c)
+		request(newServer(), "10.0.0.1", "adminTax", "guess")
 
-		assert.NoError(t, err)
-		assert.False(t, isValid)
+		assert.Contains(t, buf.String(), `"event":"auth_failed"`)
+		assert.Contains(t, buf.String(), `"username":"adminTax"`)
+		assert.Contains(t, buf.String(), `"remote_ip":"10.0.0.1"`)
+		assert.NotContains(t, buf.String(), "guess")
 	})
 }
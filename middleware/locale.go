@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/labstack/echo/v4"
+)
+
+// Locale negotiates the response language from the Accept-Language header,
+// for i18n.FromContext.
+func Locale(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := i18n.Negotiate(c.Request().Header.Get("Accept-Language"))
+		c.Set(i18n.LangKey, lang)
+
+		h := c.Response().Header()
+		h.Add(echo.HeaderVary, "Accept-Language")
+		if lang != "" {
+			h.Set("Content-Language", lang)
+		}
+		return next(c)
+	}
+}
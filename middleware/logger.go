@@ -1,10 +1,42 @@
 package middleware
 
 import (
-	"github.com/labstack/echo/v4/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
 )
 
-var Logger = middleware.LoggerWithConfig(middleware.LoggerConfig{
-	Format:           "${time_custom} [${status}]: ${method} ${uri}\n",
-	CustomTimeFormat: "2006-01-02 15:04:05",
-})
+// Logger writes one structured line per request, tagged with the request ID
+// set by RequestID. Server errors are logged as errors and client errors as
+// warnings.
+func Logger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		code := status(c, err)
+		level := slog.LevelInfo
+		switch {
+		case code >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case code >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		args := []any{
+			slog.String("uri", c.Request().RequestURI),
+			slog.Int("status", code),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_ip", c.RealIP()),
+		}
+		if err != nil {
+			args = append(args, slog.Any("error", err))
+		}
+		helper.Logger(c).Log(c.Request().Context(), level, "request", args...)
+
+		return err
+	}
+}
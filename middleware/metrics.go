@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics records the duration of each request by its route, not its URI, so
+// ids in the path do not create a series each.
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.RequestDuration.
+			WithLabelValues(c.Request().Method, route, strconv.Itoa(status(c, err))).
+			Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// status returns the status the response will have once err is handled.
+func status(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	return helper.StatusOf(err)
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	e.Use(Metrics)
+	e.GET("/items/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return echo.ErrNotFound
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, id := range []string{"1", "2", "missing"} {
+		req := httptest.NewRequest(http.MethodGet, "/items/"+id, nil)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Requests should be recorded by route", func(t *testing.T) {
+		assert.Equal(t, 2, testutil.CollectAndCount(metrics.RequestDuration.MustCurryWith(map[string]string{"route": "/items/:id"})))
+	})
+
+	t.Run("Status should come from the returned error", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		metrics.Handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec))
+
+		assert.Contains(t, rec.Body.String(), `ktaxes_http_request_duration_seconds_count{method="GET",route="/items/:id",status="200"} 2`)
+		assert.Contains(t, rec.Body.String(), `ktaxes_http_request_duration_seconds_count{method="GET",route="/items/:id",status="404"} 1`)
+	})
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+// Validate rejects request bodies that do not match the OpenAPI spec with a
+// 400 problem document. With responses, it also checks what the handler sent
+// back and replaces a response the spec does not allow with a 500, which is
+// meant for tests and staging as it holds every response in memory.
+func Validate(v *openapi.Validator, responses bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := v.ValidateRequest(c.Request())
+			var invalid helper.ValidationError
+			if errors.As(err, &invalid) {
+				return helper.Invalid("invalid request", invalid)
+			}
+			if err != nil {
+				return err
+			}
+			if !responses {
+				return next(c)
+			}
+
+			res := c.Response()
+			w := &bufferedWriter{ResponseWriter: res.Writer}
+			res.Writer = w
+			// Errors are turned into responses here so they are checked too.
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			res.Writer = w.ResponseWriter
+			if w.status == 0 {
+				return nil
+			}
+
+			req := c.Request()
+			if err := v.ValidateResponse(req.Method, req.URL.Path, w.status, res.Header().Get(echo.HeaderContentType), w.body.Bytes()); err != nil {
+				helper.Logger(c).Error("response does not match the OpenAPI spec", slog.Any("error", err))
+				body, _ := json.Marshal(helper.ErrorRes("response does not match the OpenAPI spec"))
+				res.Header().Del(echo.HeaderContentLength)
+				res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+				res.Status, w.status = http.StatusInternalServerError, http.StatusInternalServerError
+				w.body.Reset()
+				w.body.Write(body)
+			}
+			res.Writer.WriteHeader(w.status)
+			_, err = res.Writer.Write(w.body.Bytes())
+			return err
+		}
+	}
+}
+
+// bufferedWriter holds a response until it has been checked.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
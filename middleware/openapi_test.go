@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	v, err := openapi.NewValidator(openapi.Spec)
+	assert.NoError(t, err)
+
+	var received string
+	var limits interface{}
+	e := echo.New()
+	e.HTTPErrorHandler = helper.ErrorHandler
+	admin := e.Group("/admin", Validate(v, true))
+	admin.POST("/deductions/:type", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		received = string(body)
+		return c.JSON(http.StatusOK, map[string]float64{"personalDeduction": 70000, "version": 2})
+	})
+	admin.GET("/limits", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, limits)
+	})
+	admin.GET("/config", func(c echo.Context) error {
+		return helper.NotFound("config not found", nil)
+	})
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Valid request should reach the handler with its body", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/admin/deductions/personal", `{"amount": 70000}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"amount": 70000}`, received)
+		assert.JSONEq(t, `{"personalDeduction": 70000, "version": 2}`, rec.Body.String())
+	})
+
+	t.Run("Invalid request should return a problem document", func(t *testing.T) {
+		received = ""
+		rec := serve(http.MethodPost, "/admin/deductions/personal", `{"amount": -1, "effectiveFrom": "tomorrow"}`)
+
+		var p helper.Problem
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, helper.MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, helper.ValidationError{
+			{Pointer: "/amount", Rule: "gte", Limit: 0.0, Message: "amount must be greater than or equal to 0"},
+			{Pointer: "/effectiveFrom", Rule: "format", Limit: "date-time", Message: "effectiveFrom is invalid"},
+		}, p.Errors)
+		assert.Empty(t, received)
+	})
+
+	t.Run("Response matching the spec should be sent", func(t *testing.T) {
+		limits = map[string]interface{}{"maxDonation": 100000, "kReceipt": map[string]float64{"min": 0, "max": 100000}}
+		rec := serve(http.MethodGet, "/admin/limits", "")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "maxDonation")
+	})
+
+	t.Run("Response breaking the spec should be replaced with 500", func(t *testing.T) {
+		limits = map[string]interface{}{"maxDonation": "100000"}
+		rec := serve(http.MethodGet, "/admin/limits", "")
+
+		var res helper.ErrorResponse
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, "response does not match the OpenAPI spec", res.Message)
+	})
+
+	t.Run("Undocumented error status should be replaced with 500", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/admin/config", "")
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
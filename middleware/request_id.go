@@ -0,0 +1,9 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RequestID reuses the X-Request-Id header of the request or generates one,
+// and echoes it back on the response.
+var RequestID = middleware.RequestID()
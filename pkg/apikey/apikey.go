@@ -0,0 +1,92 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	KEY_PREFIX = "ktx_"
+
+	DEFAULT_RATE_LIMIT = 60
+	DEFAULT_DAILY_ROWS = 10000
+)
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrKeyRevoked  = errors.New("api key is revoked")
+)
+
+// Key identifies a client application. Only the SHA-256 hash of the secret
+// is stored; the secret itself is returned once, when the key is issued.
+type Key struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	Secret string `json:"key,omitempty"`
+	// RateLimit is the number of requests allowed per minute.
+	RateLimit int `json:"rateLimit"`
+	// DailyRows is the number of CSV rows allowed per day, 0 for no limit.
+	DailyRows int        `json:"dailyRows"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type Store interface {
+	CreateKey(context.Context, Key) (Key, error)
+	GetKey(ctx context.Context, hash string) (Key, error)
+	ListKeys(context.Context) ([]Key, error)
+	RevokeKey(ctx context.Context, id int64) (Key, error)
+}
+
+// NewStore keeps keys in Postgres, or in memory when db is nil because the
+// config store is not Postgres.
+func NewStore(db *sql.DB) Store {
+	if db == nil {
+		return NewMemory()
+	}
+	return &Postgres{Db: db}
+}
+
+// NewKey generates the secret of a key, ready to be stored.
+func NewKey(name string, rateLimit int, dailyRows int) (Key, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, err
+	}
+	secret := KEY_PREFIX + hex.EncodeToString(b)
+
+	return Key{
+		Name:      name,
+		Prefix:    secret[:len(KEY_PREFIX)+8],
+		Hash:      Hash(secret),
+		Secret:    secret,
+		RateLimit: rateLimit,
+		DailyRows: dailyRows,
+	}, nil
+}
+
+// Hash returns the stored form of a key. Keys are long random strings, so a
+// fast hash is enough.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the key with the given secret unless it is revoked.
+func Lookup(ctx context.Context, s Store, secret string) (Key, error) {
+	k, err := s.GetKey(ctx, Hash(secret))
+	if err != nil {
+		return Key{}, err
+	}
+	if k.RevokedAt != nil {
+		return Key{}, ErrKeyRevoked
+	}
+	return k, nil
+}
@@ -0,0 +1,81 @@
+package apikey_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	store := apikey.NewMemory()
+	k, err := apikey.NewKey("mobile app", 60, 1000)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(k.Secret, apikey.KEY_PREFIX))
+	assert.True(t, strings.HasPrefix(k.Secret, k.Prefix))
+	assert.NotContains(t, k.Hash, k.Secret)
+	k, _ = store.CreateKey(context.Background(), k)
+
+	t.Run("Issued key should be found", func(t *testing.T) {
+		found, err := apikey.Lookup(context.Background(), store, k.Secret)
+
+		assert.NoError(t, err)
+		assert.Equal(t, k.ID, found.ID)
+		assert.Empty(t, found.Secret)
+	})
+
+	t.Run("Unknown key should return error", func(t *testing.T) {
+		_, err := apikey.Lookup(context.Background(), store, "ktx_unknown")
+
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+	})
+
+	t.Run("Revoked key should return error", func(t *testing.T) {
+		_, err := store.RevokeKey(context.Background(), k.ID)
+		assert.NoError(t, err)
+
+		_, err = apikey.Lookup(context.Background(), store, k.Secret)
+
+		assert.ErrorIs(t, err, apikey.ErrKeyRevoked)
+	})
+}
+
+func TestAnonymousFromEnv(t *testing.T) {
+	t.Run("Anonymous access should be on by default", func(t *testing.T) {
+		k, err := apikey.AnonymousFromEnv()
+
+		assert.NoError(t, err)
+		assert.Equal(t, apikey.DEFAULT_ANONYMOUS_RATE_LIMIT, k.RateLimit)
+		assert.Equal(t, 0, k.DailyRows)
+	})
+
+	t.Run("Limits should be read", func(t *testing.T) {
+		t.Setenv("ANONYMOUS_RATE_LIMIT", "30")
+		t.Setenv("ANONYMOUS_CSV_ROWS_PER_DAY", "500")
+
+		k, err := apikey.AnonymousFromEnv()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 30, k.RateLimit)
+		assert.Equal(t, 500, k.DailyRows)
+	})
+
+	t.Run("Disabled anonymous access should return nil", func(t *testing.T) {
+		t.Setenv("ANONYMOUS_ACCESS", "false")
+
+		k, err := apikey.AnonymousFromEnv()
+
+		assert.NoError(t, err)
+		assert.Nil(t, k)
+	})
+
+	t.Run("Invalid limit should return error", func(t *testing.T) {
+		t.Setenv("ANONYMOUS_RATE_LIMIT", "0")
+
+		_, err := apikey.AnonymousFromEnv()
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,69 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const DEFAULT_CACHE_TTL = 30 * time.Second
+
+// Cache is a Store that keeps keys looked up by hash for up to TTL, so
+// requests do not each query the database. Keys revoked through the cache are
+// dropped at once; keys revoked on other instances are picked up when their
+// entry expires.
+type Cache struct {
+	Store
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedKey
+	now     func() time.Time
+}
+
+type cachedKey struct {
+	key     Key
+	expires time.Time
+}
+
+func NewCache(s Store, ttl time.Duration) *Cache {
+	return &Cache{Store: s, TTL: ttl, entries: map[string]cachedKey{}, now: time.Now}
+}
+
+func (c *Cache) GetKey(ctx context.Context, hash string) (Key, error) {
+	c.mu.Lock()
+	e, ok := c.entries[hash]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expires) {
+		return e.key, nil
+	}
+
+	k, err := c.Store.GetKey(ctx, hash)
+	if err != nil {
+		return Key{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for h, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, h)
+		}
+	}
+	c.entries[hash] = cachedKey{key: k, expires: now.Add(c.TTL)}
+	return k, nil
+}
+
+func (c *Cache) RevokeKey(ctx context.Context, id int64) (Key, error) {
+	k, err := c.Store.RevokeKey(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+
+	c.mu.Lock()
+	delete(c.entries, k.Hash)
+	c.mu.Unlock()
+	return k, nil
+}
@@ -0,0 +1,71 @@
+package apikey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingStore struct {
+	apikey.Store
+	gets int
+}
+
+func (s *countingStore) GetKey(ctx context.Context, hash string) (apikey.Key, error) {
+	s.gets++
+	return s.Store.GetKey(ctx, hash)
+}
+
+func TestCache(t *testing.T) {
+	setup := func(ttl time.Duration) (*countingStore, *apikey.Cache, apikey.Key) {
+		store := &countingStore{Store: apikey.NewMemory()}
+		k, _ := apikey.NewKey("mobile app", 60, 0)
+		k, _ = store.CreateKey(context.Background(), k)
+		return store, apikey.NewCache(store, ttl), k
+	}
+
+	t.Run("Lookups within the TTL should not query the store", func(t *testing.T) {
+		store, cache, k := setup(time.Minute)
+
+		apikey.Lookup(context.Background(), cache, k.Secret)
+		got, err := apikey.Lookup(context.Background(), cache, k.Secret)
+
+		assert.NoError(t, err)
+		assert.Equal(t, k.ID, got.ID)
+		assert.Equal(t, 1, store.gets)
+	})
+
+	t.Run("Expired lookups should query the store again", func(t *testing.T) {
+		store, cache, k := setup(time.Nanosecond)
+
+		apikey.Lookup(context.Background(), cache, k.Secret)
+		time.Sleep(time.Millisecond)
+		apikey.Lookup(context.Background(), cache, k.Secret)
+
+		assert.Equal(t, 2, store.gets)
+	})
+
+	t.Run("Revoking through the cache should take effect at once", func(t *testing.T) {
+		_, cache, k := setup(time.Minute)
+		apikey.Lookup(context.Background(), cache, k.Secret)
+
+		_, err := cache.RevokeKey(context.Background(), k.ID)
+		assert.NoError(t, err)
+		_, err = apikey.Lookup(context.Background(), cache, k.Secret)
+
+		assert.ErrorIs(t, err, apikey.ErrKeyRevoked)
+	})
+
+	t.Run("Unknown keys should not be cached", func(t *testing.T) {
+		store, cache, _ := setup(time.Minute)
+
+		apikey.Lookup(context.Background(), cache, "ktx_unknown")
+		_, err := apikey.Lookup(context.Background(), cache, "ktx_unknown")
+
+		assert.ErrorIs(t, err, apikey.ErrKeyNotFound)
+		assert.Equal(t, 2, store.gets)
+	})
+}
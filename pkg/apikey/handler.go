@@ -0,0 +1,78 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	Store Store
+}
+
+func NewHandler(s Store) Handler {
+	return Handler{Store: s}
+}
+
+type CreateKeyBody struct {
+	Name      string `json:"name" validate:"required"`
+	RateLimit *int   `json:"rateLimit" validate:"omitempty,gt=0"`
+	DailyRows *int   `json:"dailyRows" validate:"omitempty,gte=0"`
+}
+
+// CreateKeyHandler issues a key. The response is the only time the key
+// itself is shown.
+func (h Handler) CreateKeyHandler(c echo.Context) error {
+	var body CreateKeyBody
+	if err := c.Bind(&body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+	if err := c.Validate(body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	rateLimit, dailyRows := DEFAULT_RATE_LIMIT, DEFAULT_DAILY_ROWS
+	if body.RateLimit != nil {
+		rateLimit = *body.RateLimit
+	}
+	if body.DailyRows != nil {
+		dailyRows = *body.DailyRows
+	}
+
+	k, err := NewKey(body.Name, rateLimit, dailyRows)
+	if err != nil {
+		return err
+	}
+	k, err = h.Store.CreateKey(c.Request().Context(), k)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, k)
+}
+
+func (h Handler) ListKeysHandler(c echo.Context) error {
+	keys, err := h.Store.ListKeys(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (h Handler) RevokeKeyHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	k, err := h.Store.RevokeKey(c.Request().Context(), id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return helper.NotFound(err.Error(), err)
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, k)
+}
@@ -0,0 +1,65 @@
+package apikey_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	store := apikey.NewMemory()
+	e := echo.New()
+	e.HTTPErrorHandler = helper.ErrorHandler
+	e.Validator = helper.NewValidator()
+	apikey.NewHandler(store).RegisterRoutes(e.Group("/admin"))
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := openapitest.NewRecorder(t, req.Method, req.URL.Path)
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Created key should be shown once", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/admin/api-keys", `{"name": "mobile app", "rateLimit": 30}`)
+
+		var k apikey.Key
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &k))
+		assert.NotEmpty(t, k.Secret)
+		assert.Equal(t, 30, k.RateLimit)
+		assert.Equal(t, apikey.DEFAULT_DAILY_ROWS, k.DailyRows)
+
+		rec = serve(http.MethodGet, "/admin/api-keys", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), k.Secret)
+	})
+
+	t.Run("Missing name should return 400", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/admin/api-keys", `{"rateLimit": 30}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		k, _ := apikey.NewKey("partner", 60, 0)
+		k, _ = store.CreateKey(context.Background(), k)
+
+		rec := serve(http.MethodDelete, "/admin/api-keys/"+strconv.FormatInt(k.ID, 10), "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serve(http.MethodDelete, "/admin/api-keys/99", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,147 @@
+package apikey
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const DEFAULT_ANONYMOUS_RATE_LIMIT = 600
+
+// LIMITER_IDLE is how long a key's rate limiter is kept unused. Rate limits
+// are per minute, so by then it has refilled and forgetting it changes
+// nothing.
+const LIMITER_IDLE = time.Minute
+
+// Limiter enforces the request rate and the daily CSV row quota of each key.
+// Counts are kept in memory, so each instance enforces them on its own.
+// Idle limiters and past days' quotas are dropped every LIMITER_IDLE.
+type Limiter struct {
+	mu       sync.Mutex
+	requests map[int64]*bucket
+	rows     map[int64]*usage
+	swept    time.Time
+	now      func() time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+type usage struct {
+	day  time.Time
+	rows int
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{requests: map[int64]*bucket{}, rows: map[int64]*usage{}, now: time.Now}
+}
+
+// sweep drops the limiters idle for LIMITER_IDLE and the quotas of past days.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < LIMITER_IDLE {
+		return
+	}
+	l.swept = now
+
+	for id, b := range l.requests {
+		if now.Sub(b.last) >= LIMITER_IDLE {
+			delete(l.requests, id)
+		}
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	for id, u := range l.rows {
+		if u.day.Before(today) {
+			delete(l.rows, id)
+		}
+	}
+}
+
+// Allow takes one request from the key's rate limit. When none is left it
+// returns how long until the next one is.
+func (l *Limiter) Allow(k Key) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	l.sweep(now)
+	b, ok := l.requests[k.ID]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(float64(k.RateLimit)/60), k.RateLimit)}
+		l.requests[k.ID] = b
+	}
+	b.last = now
+	lim := b.limiter
+	l.mu.Unlock()
+
+	r := lim.ReserveN(now, 1)
+	if !r.OK() {
+		return false, time.Minute
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// AllowRows takes n CSV rows from the key's quota for the current UTC day.
+// When not enough are left nothing is taken, and it returns how long until
+// the quota resets.
+func (l *Limiter) AllowRows(k Key, n int) (bool, time.Duration) {
+	if k.DailyRows == 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	l.sweep(now)
+	day := now.Truncate(24 * time.Hour)
+	u, ok := l.rows[k.ID]
+	if !ok || !u.day.Equal(day) {
+		u = &usage{day: day}
+		l.rows[k.ID] = u
+	}
+
+	if u.rows+n > k.DailyRows {
+		return false, day.Add(24 * time.Hour).Sub(now)
+	}
+	u.rows += n
+	return true, 0
+}
+
+// AnonymousFromEnv returns the key shared by every request without an API
+// key, from ANONYMOUS_RATE_LIMIT (requests per minute, default 600) and
+// ANONYMOUS_CSV_ROWS_PER_DAY (default 0, no limit). It returns nil when
+// ANONYMOUS_ACCESS is false and an API key is required.
+func AnonymousFromEnv() (*Key, error) {
+	if os.Getenv("ANONYMOUS_ACCESS") == "false" {
+		return nil, nil
+	}
+
+	k := Key{Name: "anonymous", RateLimit: DEFAULT_ANONYMOUS_RATE_LIMIT}
+	for name, dst := range map[string]*int{
+		"ANONYMOUS_RATE_LIMIT":       &k.RateLimit,
+		"ANONYMOUS_CSV_ROWS_PER_DAY": &k.DailyRows,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("err: invalid %s %q", name, v)
+		}
+		*dst = n
+	}
+	if k.RateLimit == 0 {
+		return nil, fmt.Errorf("err: ANONYMOUS_RATE_LIMIT must be greater than 0")
+	}
+	return &k, nil
+}
@@ -0,0 +1,99 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	newLimiter := func() *Limiter {
+		l := NewLimiter()
+		l.now = func() time.Time { return now }
+		return l
+	}
+
+	t.Run("Requests over the rate limit should wait", func(t *testing.T) {
+		l := newLimiter()
+		k := Key{ID: 1, RateLimit: 2}
+
+		ok1, _ := l.Allow(k)
+		ok2, _ := l.Allow(k)
+		ok3, retryAfter := l.Allow(k)
+
+		assert.True(t, ok1)
+		assert.True(t, ok2)
+		assert.False(t, ok3)
+		assert.Equal(t, 30*time.Second, retryAfter)
+	})
+
+	t.Run("Keys should be limited separately", func(t *testing.T) {
+		l := newLimiter()
+
+		l.Allow(Key{ID: 1, RateLimit: 1})
+		ok, _ := l.Allow(Key{ID: 2, RateLimit: 1})
+
+		assert.True(t, ok)
+	})
+
+	t.Run("Rows over the daily quota should wait for the next day", func(t *testing.T) {
+		l := newLimiter()
+		k := Key{ID: 1, DailyRows: 100}
+
+		ok1, _ := l.AllowRows(k, 60)
+		ok2, retryAfter := l.AllowRows(k, 60)
+		ok3, _ := l.AllowRows(k, 40)
+
+		assert.True(t, ok1)
+		assert.False(t, ok2)
+		assert.Equal(t, time.Hour, retryAfter)
+		assert.True(t, ok3)
+	})
+
+	t.Run("Quota should reset the next day", func(t *testing.T) {
+		l := newLimiter()
+		k := Key{ID: 1, DailyRows: 100}
+
+		l.AllowRows(k, 100)
+		now = now.Add(2 * time.Hour)
+		ok, _ := l.AllowRows(k, 100)
+
+		assert.True(t, ok)
+	})
+
+	t.Run("No daily quota should allow any rows", func(t *testing.T) {
+		ok, _ := newLimiter().AllowRows(Key{ID: 1}, 1000000)
+
+		assert.True(t, ok)
+	})
+
+	t.Run("Idle limiters and past quotas should be dropped", func(t *testing.T) {
+		l := newLimiter()
+		l.Allow(Key{ID: 1, RateLimit: 1})
+		l.AllowRows(Key{ID: 1, DailyRows: 100}, 10)
+
+		now = now.Add(24 * time.Hour)
+		ok, _ := l.Allow(Key{ID: 2, RateLimit: 1})
+
+		assert.True(t, ok)
+		assert.NotContains(t, l.requests, int64(1))
+		assert.NotContains(t, l.rows, int64(1))
+	})
+
+	t.Run("Limiters in use should be kept", func(t *testing.T) {
+		l := newLimiter()
+		k := Key{ID: 1, RateLimit: 2}
+		l.Allow(k)
+		l.Allow(k)
+
+		now = now.Add(LIMITER_IDLE / 2)
+		l.Allow(k)
+		now = now.Add(LIMITER_IDLE / 2)
+		ok, _ := l.Allow(Key{ID: 2, RateLimit: 1})
+
+		assert.True(t, ok)
+		assert.Contains(t, l.requests, int64(1))
+	})
+}
@@ -0,0 +1,9 @@
+package apikey
+
+import "github.com/labstack/echo/v4"
+
+func (h Handler) RegisterRoutes(e *echo.Group) {
+	e.GET("/api-keys", h.ListKeysHandler)
+	e.POST("/api-keys", h.CreateKeyHandler)
+	e.DELETE("/api-keys/:id", h.RevokeKeyHandler)
+}
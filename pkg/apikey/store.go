@@ -0,0 +1,144 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Postgres struct {
+	Db *sql.DB
+}
+
+const keyColumns = "id, name, prefix, key_hash, rate_limit, daily_rows, created_at, revoked_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row scanner) (k Key, err error) {
+	var revokedAt sql.NullTime
+	err = row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &k.RateLimit, &k.DailyRows, &k.CreatedAt, &revokedAt)
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return k, err
+}
+
+func (p *Postgres) CreateKey(ctx context.Context, k Key) (Key, error) {
+	err := p.Db.QueryRowContext(ctx,
+		"INSERT INTO api_keys (name, prefix, key_hash, rate_limit, daily_rows) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		k.Name, k.Prefix, k.Hash, k.RateLimit, k.DailyRows,
+	).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+func (p *Postgres) GetKey(ctx context.Context, hash string) (Key, error) {
+	k, err := scanKey(p.Db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE key_hash = $1", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+func (p *Postgres) ListKeys(ctx context.Context) ([]Key, error) {
+	rows, err := p.Db.QueryContext(ctx, "SELECT "+keyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (p *Postgres) RevokeKey(ctx context.Context, id int64) (Key, error) {
+	k, err := scanKey(p.Db.QueryRowContext(ctx,
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 RETURNING "+keyColumns, id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// Memory keeps keys in memory, for running without Postgres.
+type Memory struct {
+	mu   sync.Mutex
+	keys map[int64]Key
+}
+
+func NewMemory() *Memory {
+	return &Memory{keys: map[int64]Key{}}
+}
+
+func (m *Memory) CreateKey(ctx context.Context, k Key) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k.ID = int64(len(m.keys)) + 1
+	k.CreatedAt = time.Now()
+	stored := k
+	stored.Secret = ""
+	m.keys[k.ID] = stored
+	return k, nil
+}
+
+func (m *Memory) GetKey(ctx context.Context, hash string) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return Key{}, ErrKeyNotFound
+}
+
+func (m *Memory) ListKeys(ctx context.Context) ([]Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := []Key{}
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m *Memory) RevokeKey(ctx context.Context, id int64) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[id]
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		now := time.Now()
+		k.RevokedAt = &now
+		m.keys[id] = k
+	}
+	return k, nil
+}
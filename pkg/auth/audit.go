@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// AuthEvent is what an audit entry records.
+var AuthEvent = struct {
+	Failed    string
+	LockedOut string
+}{
+	Failed:    "auth_failed",
+	LockedOut: "auth_locked_out",
+}
+
+// LoginAudit is a failed or rejected admin login.
+type LoginAudit struct {
+	ID        int64         `json:"id"`
+	Event     string        `json:"event"`
+	Username  string        `json:"username"`
+	RemoteIP  string        `json:"remoteIp"`
+	Attempts  int           `json:"attempts"`
+	LockedFor time.Duration `json:"-"`
+	RequestID string        `json:"requestId,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// AuditStore keeps login audit entries. Entries are only ever appended.
+type AuditStore interface {
+	RecordLogin(context.Context, LoginAudit) error
+}
+
+// NewAuditStore keeps the audit in Postgres, or in memory when db is nil.
+func NewAuditStore(db *sql.DB) AuditStore {
+	if db == nil {
+		return &MemoryAudit{}
+	}
+	return &PostgresAudit{Db: db}
+}
+
+type PostgresAudit struct {
+	Db *sql.DB
+}
+
+func (p *PostgresAudit) RecordLogin(ctx context.Context, a LoginAudit) error {
+	_, err := p.Db.ExecContext(ctx,
+		"INSERT INTO auth_audit (event, username, remote_ip, attempts, locked_for_ms, request_id) VALUES ($1, $2, $3, $4, $5, $6)",
+		a.Event, a.Username, a.RemoteIP, a.Attempts, a.LockedFor.Milliseconds(), a.RequestID,
+	)
+	return err
+}
+
+// MemoryAudit keeps the audit in memory, for running without Postgres.
+type MemoryAudit struct {
+	mu      sync.Mutex
+	entries []LoginAudit
+}
+
+func (m *MemoryAudit) RecordLogin(ctx context.Context, a LoginAudit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a.ID = int64(len(m.entries)) + 1
+	a.CreatedAt = time.Now()
+	m.entries = append(m.entries, a)
+	return nil
+}
+
+// Entries returns a copy of the audit, oldest first.
+func (m *MemoryAudit) Entries() []LoginAudit {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]LoginAudit(nil), m.entries...)
+}
@@ -0,0 +1,30 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresAudit(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectExec("INSERT INTO auth_audit").
+		WithArgs(auth.AuthEvent.Failed, "adminTax", "10.0.0.1", 5, int64(30000), "req-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := (&auth.PostgresAudit{Db: db}).RecordLogin(context.Background(), auth.LoginAudit{
+		Event:     auth.AuthEvent.Failed,
+		Username:  "adminTax",
+		RemoteIP:  "10.0.0.1",
+		Attempts:  5,
+		LockedFor: auth.LOCKOUT_BASE,
+		RequestID: "req-1",
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
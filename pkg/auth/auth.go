@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidRole        = errors.New("role must be viewer or editor")
+)
+
+// Role is what an admin user may do: viewers may only read, editors may also
+// change the config.
+var Role = struct {
+	Viewer string
+	Editor string
+}{
+	Viewer: "viewer",
+	Editor: "editor",
+}
+
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type UserStore interface {
+	GetUser(ctx context.Context, username string) (User, error)
+	CreateUser(context.Context, User) (User, error)
+	CountUsers(context.Context) (int, error)
+}
+
+// NewUserStore keeps users in Postgres, or in memory when db is nil because
+// the config store is not Postgres.
+func NewUserStore(db *sql.DB) UserStore {
+	if db == nil {
+		return NewMemoryUsers()
+	}
+	return &PostgresUsers{Db: db}
+}
+
+func ValidRole(role string) bool {
+	return role == Role.Viewer || role == Role.Editor
+}
+
+// Allows reports whether role may make a request with the given method.
+func Allows(role string, method string) bool {
+	switch role {
+	case Role.Editor:
+		return true
+	case Role.Viewer:
+		return method == http.MethodGet || method == http.MethodHead
+	}
+	return false
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NewUser returns a user with the password hashed, ready to be stored.
+func NewUser(username string, password string, role string) (User, error) {
+	if username == "" || password == "" {
+		return User{}, errors.New("err: username and password are required")
+	}
+	if !ValidRole(role) {
+		return User{}, ErrInvalidRole
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	return User{Username: username, PasswordHash: hash, Role: role}, nil
+}
+
+// dummyHash is compared against when the user does not exist, so unknown
+// usernames take as long to reject as wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Authenticate returns the user when the password matches.
+func Authenticate(ctx context.Context, users UserStore, username string, password string) (User, error) {
+	u, err := users.GetUser(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// Seed creates an editor from ADMIN_USERNAME and ADMIN_PASSWORD when there are
+// no users yet, so a new deployment can log in to create the others.
+func Seed(ctx context.Context, users UserStore, username string, password string) error {
+	if username == "" || password == "" {
+		return nil
+	}
+
+	n, err := users.CountUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	u, err := NewUser(username, password, Role.Editor)
+	if err != nil {
+		return err
+	}
+	if _, err := users.CreateUser(ctx, u); err != nil {
+		return fmt.Errorf("err: failed to seed admin user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	users := auth.NewMemoryUsers()
+	u, err := auth.NewUser("adminTax", "admin!", auth.Role.Editor)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "admin!", u.PasswordHash)
+	users.CreateUser(context.Background(), u)
+
+	t.Run("Correct password should return the user", func(t *testing.T) {
+		got, err := auth.Authenticate(context.Background(), users, "adminTax", "admin!")
+
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Role.Editor, got.Role)
+	})
+
+	t.Run("Wrong password should return error", func(t *testing.T) {
+		_, err := auth.Authenticate(context.Background(), users, "adminTax", "admin")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+
+	t.Run("Unknown user should return error", func(t *testing.T) {
+		_, err := auth.Authenticate(context.Background(), users, "nobody", "admin!")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	})
+}
+
+func TestNewUser(t *testing.T) {
+	_, err := auth.NewUser("adminTax", "admin!", "owner")
+	assert.ErrorIs(t, err, auth.ErrInvalidRole)
+
+	_, err = auth.NewUser("adminTax", "", auth.Role.Viewer)
+	assert.Error(t, err)
+}
+
+func TestSeed(t *testing.T) {
+	t.Run("Empty store should get an editor", func(t *testing.T) {
+		users := auth.NewMemoryUsers()
+
+		err := auth.Seed(context.Background(), users, "adminTax", "admin!")
+
+		assert.NoError(t, err)
+		u, err := users.GetUser(context.Background(), "adminTax")
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Role.Editor, u.Role)
+	})
+
+	t.Run("Existing users should be kept as they are", func(t *testing.T) {
+		users := auth.NewMemoryUsers()
+		u, _ := auth.NewUser("viewer", "password", auth.Role.Viewer)
+		users.CreateUser(context.Background(), u)
+
+		err := auth.Seed(context.Background(), users, "adminTax", "admin!")
+
+		assert.NoError(t, err)
+		_, err = users.GetUser(context.Background(), "adminTax")
+		assert.ErrorIs(t, err, auth.ErrUserNotFound)
+	})
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, auth.Allows(auth.Role.Viewer, http.MethodGet))
+	assert.False(t, auth.Allows(auth.Role.Viewer, http.MethodPost))
+	assert.True(t, auth.Allows(auth.Role.Editor, http.MethodDelete))
+	assert.False(t, auth.Allows("", http.MethodGet))
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	Users   UserStore
+	Tokens  Tokens
+	Lockout *Lockout
+}
+
+func NewHandler(users UserStore, tokens Tokens, lockout *Lockout) Handler {
+	return Handler{Users: users, Tokens: tokens, Lockout: lockout}
+}
+
+type LoginBody struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginHandler exchanges a username and password for a bearer token.
+func (h Handler) LoginHandler(c echo.Context) error {
+	var body LoginBody
+	if err := c.Bind(&body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+	if err := c.Validate(body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	u, err := h.Lockout.Login(c, h.Users, body.Username, body.Password)
+	if errors.Is(err, ErrLockedOut) {
+		return helper.RateLimited(err.Error(), h.Lockout.Locked(body.Username, c.RealIP()))
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		return helper.Unauthorized(err.Error(), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := h.Tokens.Issue(u)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, token)
+}
@@ -0,0 +1,73 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginHandler(t *testing.T) {
+	users := auth.NewMemoryUsers()
+	u, _ := auth.NewUser("adminTax", "admin!", auth.Role.Editor)
+	users.CreateUser(context.Background(), u)
+	tokens := auth.Tokens{Secret: []byte("secret"), TTL: time.Hour}
+
+	e := echo.New()
+
+	e.HTTPErrorHandler = helper.ErrorHandler
+	e.Validator = helper.NewValidator()
+	auth.NewHandler(users, tokens, auth.NewLockout(auth.NewAuditStore(nil))).RegisterRoutes(e)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := openapitest.NewRecorder(t, req.Method, req.URL.Path)
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Valid credentials should return a token", func(t *testing.T) {
+		rec := login(`{"username": "adminTax", "password": "admin!"}`)
+
+		var res auth.Token
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, auth.Role.Editor, res.Role)
+		claims, err := tokens.Verify(res.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "adminTax", claims.Subject)
+	})
+
+	t.Run("Wrong password should return 401", func(t *testing.T) {
+		rec := login(`{"username": "adminTax", "password": "admin"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Repeated wrong passwords should return 429", func(t *testing.T) {
+		for i := 0; i < auth.MAX_FAILED_ATTEMPTS; i++ {
+			login(`{"username": "adminTax", "password": "admin"}`)
+		}
+
+		rec := login(`{"username": "adminTax", "password": "admin!"}`)
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("Missing password should return 400", func(t *testing.T) {
+		rec := login(`{"username": "adminTax"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// MAX_FAILED_ATTEMPTS is how many wrong passwords in a row are allowed
+	// for a username or an IP before it is locked out.
+	MAX_FAILED_ATTEMPTS = 5
+	// LOCKOUT_BASE is the first lockout, doubled for every further failure
+	// up to LOCKOUT_MAX.
+	LOCKOUT_BASE = 30 * time.Second
+	LOCKOUT_MAX  = 15 * time.Minute
+	// FAILURE_WINDOW is how long failures are remembered after the last one.
+	FAILURE_WINDOW = time.Hour
+	// MAX_TRACKED_KEYS bounds how many usernames and IPs are tracked, so
+	// failures from many addresses cannot grow the memory without limit.
+	// When full, the entries failed longest ago are forgotten first.
+	MAX_TRACKED_KEYS = 10000
+)
+
+var ErrLockedOut = errors.New("too many failed attempts")
+
+// Lockout tracks failed admin logins per username and per IP, so guessing
+// passwords of one user from many IPs, or of many users from one IP, are
+// both slowed down. Counts are kept in memory, so each instance tracks them
+// on its own, while failures are written to the audit store.
+type Lockout struct {
+	mu       sync.Mutex
+	failures map[string]*failures
+	audit    AuditStore
+	now      func() time.Time
+}
+
+type failures struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+func NewLockout(audit AuditStore) *Lockout {
+	return &Lockout{failures: map[string]*failures{}, audit: audit, now: time.Now}
+}
+
+func lockoutKeys(username string, ip string) []string {
+	return []string{"user:" + username, "ip:" + ip}
+}
+
+// Locked returns how long until username may log in from ip again, 0 when
+// it may now.
+func (l *Lockout) Locked(username string, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range lockoutKeys(username, ip) {
+		if f, ok := l.failures[key]; ok && f.until.After(now) {
+			wait = max(wait, f.until.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail records a wrong password and returns the number of failures in a row
+// and the lockout that starts now, if any.
+func (l *Lockout) Fail(username string, ip string) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, f := range l.failures {
+		if now.Sub(f.last) > FAILURE_WINDOW && !f.until.After(now) {
+			delete(l.failures, key)
+		}
+	}
+	l.evict(MAX_TRACKED_KEYS - len(lockoutKeys(username, ip)))
+
+	var count int
+	var lockout time.Duration
+	for _, key := range lockoutKeys(username, ip) {
+		f, ok := l.failures[key]
+		if !ok {
+			f = &failures{}
+			l.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= MAX_FAILED_ATTEMPTS {
+			d := LOCKOUT_MAX
+			if shift := f.count - MAX_FAILED_ATTEMPTS; shift < 16 {
+				d = min(LOCKOUT_BASE<<shift, LOCKOUT_MAX)
+			}
+			f.until = now.Add(d)
+			lockout = max(lockout, d)
+		}
+		count = max(count, f.count)
+	}
+	return count, lockout
+}
+
+// evict forgets the entries failed longest ago until at most n are left.
+func (l *Lockout) evict(n int) {
+	if len(l.failures) <= n {
+		return
+	}
+	keys := make([]string, 0, len(l.failures))
+	for key := range l.failures {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return l.failures[keys[i]].last.Before(l.failures[keys[j]].last)
+	})
+	for _, key := range keys[:len(keys)-n] {
+		delete(l.failures, key)
+	}
+}
+
+// Reset forgets the failures of username after a successful login. The
+// failures of the IP are kept, so an attacker who owns one account cannot
+// log in to it to clear the lockout of the address guessing at others.
+func (l *Lockout) Reset(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, "user:"+username)
+}
+
+// Login authenticates username from the client IP of c unless it is locked
+// out, and writes every failure to the log and the audit store.
+func (l *Lockout) Login(c echo.Context, users UserStore, username string, password string) (User, error) {
+	ip := c.RealIP()
+	if wait := l.Locked(username, ip); wait > 0 {
+		helper.Logger(c).Warn("admin login rejected",
+			slog.String("event", "auth_locked_out"),
+			slog.String("username", username),
+			slog.String("remote_ip", ip),
+			slog.Duration("retry_after", wait),
+		)
+		l.record(c, LoginAudit{Event: AuthEvent.LockedOut, Username: username, RemoteIP: ip, LockedFor: wait})
+		return User{}, ErrLockedOut
+	}
+
+	u, err := Authenticate(c.Request().Context(), users, username, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		count, lockout := l.Fail(username, ip)
+		helper.Logger(c).Warn("admin login failed",
+			slog.String("event", "auth_failed"),
+			slog.String("username", username),
+			slog.String("remote_ip", ip),
+			slog.Int("attempts", count),
+			slog.Duration("locked_for", lockout),
+		)
+		l.record(c, LoginAudit{Event: AuthEvent.Failed, Username: username, RemoteIP: ip, Attempts: count, LockedFor: lockout})
+		return User{}, err
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	l.Reset(username)
+	return u, nil
+}
+
+// record writes a to the audit store. A failing store is logged but does not
+// change the outcome of the login.
+func (l *Lockout) record(c echo.Context, a LoginAudit) {
+	if l.audit == nil {
+		return
+	}
+	a.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	if err := l.audit.RecordLogin(c.Request().Context(), a); err != nil {
+		helper.Logger(c).Error("failed to write login audit",
+			slog.String("event", a.Event),
+			slog.String("username", a.Username),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newLockout := func() *Lockout {
+		l := NewLockout(&MemoryAudit{})
+		l.now = func() time.Time { return now }
+		return l
+	}
+
+	t.Run("Lockout should double for every further failure", func(t *testing.T) {
+		l := newLockout()
+		for i := 0; i < MAX_FAILED_ATTEMPTS-1; i++ {
+			_, lockout := l.Fail("adminTax", "10.0.0.1")
+			assert.Zero(t, lockout)
+		}
+
+		count, first := l.Fail("adminTax", "10.0.0.1")
+		_, second := l.Fail("adminTax", "10.0.0.1")
+		_, third := l.Fail("adminTax", "10.0.0.1")
+
+		assert.Equal(t, MAX_FAILED_ATTEMPTS, count)
+		assert.Equal(t, LOCKOUT_BASE, first)
+		assert.Equal(t, 2*LOCKOUT_BASE, second)
+		assert.Equal(t, 4*LOCKOUT_BASE, third)
+		assert.Equal(t, third, l.Locked("adminTax", "10.0.0.2"))
+		assert.Equal(t, third, l.Locked("other", "10.0.0.1"))
+		assert.Zero(t, l.Locked("other", "10.0.0.2"))
+	})
+
+	t.Run("Lockout should not exceed the maximum", func(t *testing.T) {
+		l := newLockout()
+		var lockout time.Duration
+		for i := 0; i < 100; i++ {
+			_, lockout = l.Fail("adminTax", "10.0.0.1")
+		}
+
+		assert.Equal(t, LOCKOUT_MAX, lockout)
+	})
+
+	t.Run("Lockout should expire", func(t *testing.T) {
+		l := newLockout()
+		for i := 0; i < MAX_FAILED_ATTEMPTS; i++ {
+			l.Fail("adminTax", "10.0.0.1")
+		}
+
+		now = now.Add(LOCKOUT_BASE)
+
+		assert.Zero(t, l.Locked("adminTax", "10.0.0.1"))
+	})
+
+	t.Run("Failures should be forgotten after the window", func(t *testing.T) {
+		l := newLockout()
+		for i := 0; i < MAX_FAILED_ATTEMPTS-1; i++ {
+			l.Fail("adminTax", "10.0.0.1")
+		}
+
+		now = now.Add(FAILURE_WINDOW + time.Second)
+		count, lockout := l.Fail("adminTax", "10.0.0.1")
+
+		assert.Equal(t, 1, count)
+		assert.Zero(t, lockout)
+	})
+
+	t.Run("Reset should keep the failures of the IP", func(t *testing.T) {
+		l := newLockout()
+		for i := 0; i < MAX_FAILED_ATTEMPTS-1; i++ {
+			l.Fail("adminTax", "10.0.0.1")
+		}
+
+		l.Reset("adminTax")
+		count, lockout := l.Fail("other", "10.0.0.1")
+
+		assert.Equal(t, MAX_FAILED_ATTEMPTS, count)
+		assert.Equal(t, LOCKOUT_BASE, lockout)
+	})
+
+	t.Run("Tracked keys should be bounded", func(t *testing.T) {
+		l := newLockout()
+		for i := 0; i < MAX_TRACKED_KEYS; i++ {
+			now = now.Add(time.Millisecond)
+			l.Fail("user"+strconv.Itoa(i), "10.0.0.1")
+		}
+
+		assert.LessOrEqual(t, len(l.failures), MAX_TRACKED_KEYS)
+		assert.Contains(t, l.failures, "ip:10.0.0.1")
+		assert.Contains(t, l.failures, "user:user"+strconv.Itoa(MAX_TRACKED_KEYS-1))
+		assert.NotContains(t, l.failures, "user:user0")
+	})
+}
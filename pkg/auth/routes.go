@@ -0,0 +1,7 @@
+package auth
+
+import "github.com/labstack/echo/v4"
+
+func (h Handler) RegisterRoutes(e *echo.Echo, m ...echo.MiddlewareFunc) {
+	e.POST("/admin/login", h.LoginHandler, m...)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DEFAULT_TOKEN_TTL = time.Hour
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Token struct {
+	Token     string    `json:"token"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Tokens issues and verifies HS256 signed JWTs.
+type Tokens struct {
+	Secret []byte
+	TTL    time.Duration
+}
+
+// TokensFromEnv reads AUTH_TOKEN_SECRET and AUTH_TOKEN_TTL. Without a secret
+// a random one is used, so tokens stop working on restart and are not
+// accepted by other instances.
+func TokensFromEnv() (t Tokens, generated bool, err error) {
+	t = Tokens{Secret: []byte(os.Getenv("AUTH_TOKEN_SECRET")), TTL: DEFAULT_TOKEN_TTL}
+
+	if v := os.Getenv("AUTH_TOKEN_TTL"); v != "" {
+		if t.TTL, err = time.ParseDuration(v); err != nil || t.TTL <= 0 {
+			return Tokens{}, false, fmt.Errorf("err: invalid AUTH_TOKEN_TTL %q", v)
+		}
+	}
+
+	if len(t.Secret) == 0 {
+		t.Secret = make([]byte, 32)
+		if _, err := rand.Read(t.Secret); err != nil {
+			return Tokens{}, false, err
+		}
+		generated = true
+	}
+	return t, generated, nil
+}
+
+func (t Tokens) Issue(u User) (Token, error) {
+	now := time.Now().Truncate(time.Second)
+	expiresAt := now.Add(t.TTL)
+	claims := Claims{
+		Role: u.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   u.Username,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.Secret)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Token: signed, Role: u.Role, ExpiresAt: expiresAt}, nil
+}
+
+// Verify returns the claims of a token signed with Secret that has not
+// expired.
+func (t Tokens) Verify(token string) (Claims, error) {
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(tok *jwt.Token) (interface{}, error) {
+		return t.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid || claims.Subject == "" || !ValidRole(claims.Role) {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// VerifyUser returns the user a token was issued to as they are now, so a
+// user who was removed or whose role changed does not keep the access of the
+// token. A user created again under the same name does not get the tokens of
+// the old one.
+func (t Tokens) VerifyUser(ctx context.Context, users UserStore, token string) (User, error) {
+	claims, err := t.Verify(token)
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := users.GetUser(ctx, claims.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, ErrInvalidToken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.Before(u.CreatedAt.Truncate(time.Second)) {
+		return User{}, ErrInvalidToken
+	}
+	return u, nil
+}
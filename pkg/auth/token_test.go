@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := auth.Tokens{Secret: []byte("secret"), TTL: time.Hour}
+	u := auth.User{Username: "adminTax", Role: auth.Role.Viewer}
+
+	t.Run("Issued token should verify", func(t *testing.T) {
+		token, err := tokens.Issue(u)
+		assert.NoError(t, err)
+
+		claims, err := tokens.Verify(token.Token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "adminTax", claims.Subject)
+		assert.Equal(t, auth.Role.Viewer, claims.Role)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+	})
+
+	t.Run("Expired token should not verify", func(t *testing.T) {
+		token, _ := auth.Tokens{Secret: tokens.Secret, TTL: -time.Minute}.Issue(u)
+
+		_, err := tokens.Verify(token.Token)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("Changed token should not verify", func(t *testing.T) {
+		token, _ := tokens.Issue(u)
+
+		_, err := tokens.Verify(token.Token + "x")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("Token signed with another method should not verify", func(t *testing.T) {
+		claims := auth.Claims{Role: auth.Role.Editor, RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "adminTax",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(tokens.Secret)
+
+		_, err := tokens.Verify(token)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("Token without expiry should not verify", func(t *testing.T) {
+		claims := auth.Claims{Role: auth.Role.Editor, RegisteredClaims: jwt.RegisteredClaims{Subject: "adminTax"}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokens.Secret)
+
+		_, err := tokens.Verify(token)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
+
+func TestVerifyUser(t *testing.T) {
+	tokens := auth.Tokens{Secret: []byte("secret"), TTL: time.Hour}
+	users := auth.NewMemoryUsers()
+	u, _ := auth.NewUser("adminTax", "admin!", auth.Role.Viewer)
+	users.CreateUser(context.Background(), u)
+
+	t.Run("Role should be read from the store", func(t *testing.T) {
+		token, _ := tokens.Issue(auth.User{Username: "adminTax", Role: auth.Role.Editor})
+
+		got, err := tokens.VerifyUser(context.Background(), users, token.Token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Role.Viewer, got.Role)
+	})
+
+	t.Run("Token of an unknown user should not verify", func(t *testing.T) {
+		token, _ := tokens.Issue(auth.User{Username: "nobody", Role: auth.Role.Editor})
+
+		_, err := tokens.VerifyUser(context.Background(), users, token.Token)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("Token issued before the user was created should not verify", func(t *testing.T) {
+		claims := auth.Claims{Role: auth.Role.Viewer, RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "adminTax",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokens.Secret)
+
+		_, err := tokens.VerifyUser(context.Background(), users, token)
+
+		assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
+
+func TestTokensFromEnv(t *testing.T) {
+	t.Run("Secret and TTL should be read", func(t *testing.T) {
+		t.Setenv("AUTH_TOKEN_SECRET", "secret")
+		t.Setenv("AUTH_TOKEN_TTL", "15m")
+
+		tokens, generated, err := auth.TokensFromEnv()
+
+		assert.NoError(t, err)
+		assert.False(t, generated)
+		assert.Equal(t, []byte("secret"), tokens.Secret)
+		assert.Equal(t, 15*time.Minute, tokens.TTL)
+	})
+
+	t.Run("Missing secret should be generated", func(t *testing.T) {
+		t.Setenv("AUTH_TOKEN_SECRET", "")
+		t.Setenv("AUTH_TOKEN_TTL", "")
+
+		tokens, generated, err := auth.TokensFromEnv()
+
+		assert.NoError(t, err)
+		assert.True(t, generated)
+		assert.Len(t, tokens.Secret, 32)
+		assert.Equal(t, auth.DEFAULT_TOKEN_TTL, tokens.TTL)
+	})
+
+	t.Run("Invalid TTL should return error", func(t *testing.T) {
+		t.Setenv("AUTH_TOKEN_TTL", "forever")
+
+		_, _, err := auth.TokensFromEnv()
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UNIQUE_VIOLATION is the Postgres error code for a duplicate key.
+const UNIQUE_VIOLATION = "23505"
+
+type PostgresUsers struct {
+	Db *sql.DB
+}
+
+func (p *PostgresUsers) GetUser(ctx context.Context, username string) (User, error) {
+	var u User
+	err := p.Db.QueryRowContext(ctx,
+		"SELECT id, username, password_hash, role, created_at FROM admin_users WHERE username = $1", username,
+	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (p *PostgresUsers) CreateUser(ctx context.Context, u User) (User, error) {
+	err := p.Db.QueryRowContext(ctx,
+		"INSERT INTO admin_users (username, password_hash, role) VALUES ($1, $2, $3) RETURNING id, created_at",
+		u.Username, u.PasswordHash, u.Role,
+	).Scan(&u.ID, &u.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == UNIQUE_VIOLATION {
+		return User{}, ErrUserExists
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (p *PostgresUsers) CountUsers(ctx context.Context) (n int, err error) {
+	err = p.Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admin_users").Scan(&n)
+	return n, err
+}
+
+// MemoryUsers keeps users in memory, for running without Postgres.
+type MemoryUsers struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: map[string]User{}}
+}
+
+func (m *MemoryUsers) GetUser(ctx context.Context, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *MemoryUsers) CreateUser(ctx context.Context, u User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.Username]; ok {
+		return User{}, ErrUserExists
+	}
+	u.ID = int64(len(m.users)) + 1
+	u.CreatedAt = time.Now()
+	m.users[u.Username] = u
+	return u, nil
+}
+
+func (m *MemoryUsers) CountUsers(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.users), nil
+}
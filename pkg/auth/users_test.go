@@ -0,0 +1,50 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresUsers(t *testing.T) {
+	t.Run("Unknown user should return ErrUserNotFound", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery("SELECT (.+) FROM admin_users WHERE username").
+			WithArgs("nobody").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password_hash", "role", "created_at"}))
+
+		_, err := (&auth.PostgresUsers{Db: db}).GetUser(context.Background(), "nobody")
+
+		assert.ErrorIs(t, err, auth.ErrUserNotFound)
+	})
+
+	t.Run("Created user should get an ID", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery("INSERT INTO admin_users").
+			WithArgs("viewer", "hash", auth.Role.Viewer).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(2, time.Now()))
+
+		u, err := (&auth.PostgresUsers{Db: db}).CreateUser(context.Background(), auth.User{Username: "viewer", PasswordHash: "hash", Role: auth.Role.Viewer})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), u.ID)
+	})
+
+	t.Run("Duplicate username should return ErrUserExists", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		mock.ExpectQuery("INSERT INTO admin_users").
+			WillReturnError(&pq.Error{Code: auth.UNIQUE_VIOLATION})
+
+		_, err := (&auth.PostgresUsers{Db: db}).CreateUser(context.Background(), auth.User{Username: "adminTax", PasswordHash: "hash", Role: auth.Role.Editor})
+
+		assert.ErrorIs(t, err, auth.ErrUserExists)
+	})
+}
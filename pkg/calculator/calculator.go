@@ -2,15 +2,22 @@ package calculator
 
 import (
 	"math"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
 	"github.com/jaiieth/assessment-tax/pkg/config"
 )
 
+// TOP_LEVEL_MAX_INCOME is the most income the taxLevel of the open-ended top
+// bracket shows the tax on, as it always has. The total tax is not capped.
+const TOP_LEVEL_MAX_INCOME = 2000000.0
+
 type CalculateTaxBody struct {
 	TotalIncome    float64     `json:"totalIncome" validate:"required,gte=0"`
 	WithHoldingTax float64     `json:"wht" validate:"gte=0,ltefield=TotalIncome"`
 	Allowances     []Allowance `json:"allowances" validate:"unique=Type,dive"`
+	ConfigVersion  *int64      `json:"configVersion,omitempty" validate:"omitempty,gt=0"`
+	Date           *time.Time  `json:"date,omitempty" validate:"excluded_with=ConfigVersion"`
 }
 
 type Allowance struct {
@@ -24,19 +31,23 @@ type TaxLevel struct {
 }
 
 type CalculateTaxResult struct {
-	Tax       float64    `json:"tax"`
-	TaxLevel  []TaxLevel `json:"taxLevel,omitempty"`
-	TaxRefund float64    `json:"taxRefund,omitempty"`
+	Tax           float64    `json:"tax"`
+	TaxLevel      []TaxLevel `json:"taxLevel,omitempty"`
+	TaxRefund     float64    `json:"taxRefund,omitempty"`
+	ConfigVersion int64      `json:"configVersion"`
+	CalculationID string     `json:"calculationId,omitempty"`
 }
 
 type TaxCSV struct {
-	TotalIncome    float64  `csv:"totalIncome" validate:"required,numeric,gte=0"`
-	WithHoldingTax *float64 `csv:"wht" validate:"gte=0,ltefield=TotalIncome"` //use pointer to allow 0
-	Donation       *float64 `csv:"donation" validate:"gte=0"`                 // use pointer to allow 0
+	TotalIncome    float64  `csv:"totalIncome" json:"totalIncome" validate:"required,numeric,gte=0"`
+	WithHoldingTax *float64 `csv:"wht" json:"wht" validate:"gte=0,ltefield=TotalIncome"` //use pointer to allow 0
+	Donation       *float64 `csv:"donation" json:"donation" validate:"gte=0"`            // use pointer to allow 0
 }
 
 type CalculateByCSVResponse struct {
-	Taxes []CalculateByCSVResponseItem `json:"taxes"`
+	Taxes         []CalculateByCSVResponseItem `json:"taxes"`
+	ConfigVersion int64                        `json:"configVersion"`
+	CalculationID string                       `json:"calculationId,omitempty"`
 }
 
 type CalculateByCSVResponseItem struct {
@@ -46,23 +57,26 @@ type CalculateByCSVResponseItem struct {
 }
 
 func CalculateTax(b CalculateTaxBody, c config.Config) CalculateTaxResult {
-	allowance := calculateAllowance(b.Allowances)
-	tax := GetTotalTax(b.TotalIncome-c.PersonalDeduction-allowance) - b.WithHoldingTax
+	taxable := b.taxable(c)
+	tax := TotalTax(taxable, c.Brackets()) - b.WithHoldingTax
 	var taxLevel []TaxLevel
 	if tax < 0 {
-		taxLevel = GetTaxLevels(b.TotalIncome - allowance - c.PersonalDeduction)
-		return CalculateTaxResult{0, taxLevel, math.Abs(tax)}
+		taxLevel = TaxLevels(taxable, c.Brackets())
+		return CalculateTaxResult{Tax: 0, TaxLevel: taxLevel, TaxRefund: math.Abs(tax), ConfigVersion: c.Version}
 	}
 
-	taxLevel = GetTaxLevels(b.TotalIncome - allowance - c.PersonalDeduction)
-	return CalculateTaxResult{math.Max(0, tax), taxLevel, 0}
+	taxLevel = TaxLevels(taxable, c.Brackets())
+	return CalculateTaxResult{Tax: math.Max(0, tax), TaxLevel: taxLevel, ConfigVersion: c.Version}
+}
+
+func (b CalculateTaxBody) taxable(c config.Config) float64 {
+	return b.TotalIncome - c.PersonalDeduction - calculateAllowance(b.Allowances, c)
 }
 
 func CalculateTaxes(rs []TaxCSV, c config.Config) []CalculateByCSVResponseItem {
 	res := []CalculateByCSVResponseItem{}
 	for _, r := range rs {
-		allowance := math.Min(*r.Donation, config.MAX_DONATION)
-		tax := GetTotalTax(r.TotalIncome-c.PersonalDeduction-allowance) - *r.WithHoldingTax
+		tax := TotalTax(r.taxable(c), c.Brackets()) - *r.WithHoldingTax
 		if tax < 0 {
 			res = append(res, CalculateByCSVResponseItem{r.TotalIncome, 0, math.Abs(tax)})
 			continue
@@ -74,42 +88,58 @@ func CalculateTaxes(rs []TaxCSV, c config.Config) []CalculateByCSVResponseItem {
 	return res
 }
 
+func (r TaxCSV) taxable(c config.Config) float64 {
+	allowance := math.Min(*r.Donation, c.Limits().MaxDonation)
+	return r.TotalIncome - c.PersonalDeduction - allowance
+}
+
 func GetTotalTax(taxable float64) float64 {
+	return TotalTax(taxable, config.DefaultTaxBrackets())
+}
 
-	if taxable > 2000000 {
-		return helper.RoundTwoDigits((taxable-2000000)*0.35) + GetTotalTax(2000000)
-	}
+func GetTaxLevels(taxable float64) (taxLevel []TaxLevel) {
+	return TaxLevels(taxable, config.DefaultTaxBrackets())
+}
 
-	if taxable > 1000000 {
-		return helper.RoundTwoDigits((taxable-1000000)*0.20) + GetTotalTax(1000000)
+func TotalTax(taxable float64, brackets []config.TaxBracket) (tax float64) {
+	for _, b := range brackets {
+		tax += helper.RoundTwoDigits(bracketIncome(taxable, b) * b.Rate)
 	}
+	return tax
+}
 
-	if taxable > 500000 {
-		return helper.RoundTwoDigits((taxable-500000)*0.15) + GetTotalTax(500000)
+func TaxLevels(taxable float64, brackets []config.TaxBracket) (taxLevel []TaxLevel) {
+	for _, b := range brackets {
+		income := bracketIncome(taxable, b)
+		if b.Max == 0 {
+			income = math.Min(income, TOP_LEVEL_MAX_INCOME)
+		}
+		taxLevel = append(taxLevel, TaxLevel{Level: b.Level, Tax: income * b.Rate})
 	}
+	return taxLevel
+}
 
-	if taxable > 150000 {
-		return helper.RoundTwoDigits((taxable-150000)*0.10) + GetTotalTax(150000)
+// BracketReached returns the level of the highest bracket the taxable income
+// falls in.
+func BracketReached(taxable float64, brackets []config.TaxBracket) string {
+	level := ""
+	for i, b := range brackets {
+		if i == 0 || taxable > b.Min {
+			level = b.Level
+		}
 	}
-
-	return 0.0
+	return level
 }
 
-func GetTaxLevels(taxable float64) (taxLevel []TaxLevel) {
-	taxLevel = append(taxLevel, TaxLevel{Level: "0-150,000", Tax: 0})
-	taxable = math.Max(taxable-150000, 0)
-	taxLevel = append(taxLevel, TaxLevel{Level: "150,001-500,000", Tax: (math.Min(taxable, 350000) * 0.10)})
-	taxable = math.Max(taxable-350000, 0)
-	taxLevel = append(taxLevel, TaxLevel{Level: "500,001-1,000,000", Tax: (math.Min(taxable, 500000) * 0.15)})
-	taxable = math.Max(taxable-500000, 0)
-	taxLevel = append(taxLevel, TaxLevel{Level: "1,000,001-2,000,000", Tax: (math.Min(taxable, 1000000) * 0.20)})
-	taxable = math.Max(taxable-1000000, 0)
-	taxLevel = append(taxLevel, TaxLevel{Level: "2,000,001 ขึ้นไป", Tax: (math.Min(taxable, 2000000) * 0.35)})
-
-	return taxLevel
+// bracketIncome returns the part of the taxable income that falls in the bracket.
+func bracketIncome(taxable float64, b config.TaxBracket) float64 {
+	if b.Max > 0 {
+		taxable = math.Min(taxable, b.Max)
+	}
+	return math.Max(taxable-b.Min, 0)
 }
 
-func calculateAllowance(allowances []Allowance) (allowance float64) {
+func calculateAllowance(allowances []Allowance, c config.Config) (allowance float64) {
 	donation := 0.0
 	kReceipt := 0.0
 	for _, a := range allowances {
@@ -121,8 +151,8 @@ func calculateAllowance(allowances []Allowance) (allowance float64) {
 		}
 	}
 
-	allowance += math.Min(donation, config.MAX_DONATION)
-	allowance += math.Min(kReceipt, config.DEFAULT_MAX_K_RECEIPT)
+	allowance += math.Min(donation, c.Limits().MaxDonation)
+	allowance += math.Min(kReceipt, c.MaxKReceipt)
 
 	return allowance
 }
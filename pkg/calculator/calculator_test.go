@@ -1,12 +1,14 @@
 package calculator_test
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
 	"github.com/jaiieth/assessment-tax/pkg/calculator"
@@ -32,15 +34,45 @@ type StubDatabase struct {
 	err    error
 }
 
-func (db StubDatabase) GetConfig() (config.Config, error) {
+func (db StubDatabase) GetConfig(ctx context.Context) (config.Config, error) {
 	return db.Config, nil
 }
-func (db StubDatabase) SetPersonalDeduction(float64) (config.Config, error) {
+func (db StubDatabase) GetConfigVersion(context.Context, int64) (config.Config, error) {
 	return db.Config, nil
 }
-func (db StubDatabase) SetMaxKReceipt(float64) (config.Config, error) {
+func (db StubDatabase) ListConfigVersions(ctx context.Context) ([]config.ConfigVersion, error) {
+	return []config.ConfigVersion{{Version: db.Config.Version, Config: db.Config}}, nil
+}
+func (db StubDatabase) SetDeduction(context.Context, string, float64, config.Actor) (config.Config, error) {
+	return db.Config, nil
+}
+func (db StubDatabase) SetLimits(context.Context, config.Limits, config.Actor) (config.Config, error) {
+	return db.Config, nil
+}
+func (db StubDatabase) ReplaceConfig(ctx context.Context, c config.Config, _ config.Actor) (config.Config, error) {
+	return c, nil
+}
+func (db StubDatabase) PatchConfig(context.Context, json.RawMessage, config.Actor) (config.Config, error) {
 	return db.Config, nil
 }
+func (db StubDatabase) ListAudit(context.Context, config.AuditFilter) (config.AuditPage, error) {
+	return config.AuditPage{}, nil
+}
+func (db StubDatabase) GetConfigAt(context.Context, time.Time) (config.Config, error) {
+	return db.Config, nil
+}
+func (db StubDatabase) ScheduleChange(ctx context.Context, sc config.ScheduledChange, a config.Actor) (config.ScheduledChange, error) {
+	return sc, nil
+}
+func (db StubDatabase) ListScheduledChanges(context.Context, string) ([]config.ScheduledChange, error) {
+	return []config.ScheduledChange{}, nil
+}
+func (db StubDatabase) ApplyScheduledChanges(ctx context.Context) (config.Config, error) {
+	return db.GetConfig(ctx)
+}
+func (db StubDatabase) CancelScheduledChange(context.Context, int64, config.Actor) (config.ScheduledChange, error) {
+	return config.ScheduledChange{}, nil
+}
 
 func NewContext(method string, target string, body io.Reader) (echo.Context, *httptest.ResponseRecorder) {
 	e := echo.New()
@@ -123,7 +155,7 @@ func RunTestCalculateTaxWithAlloawance(t *testing.T, cases []CalculateTaxWithAll
 		t.Run(v.name, func(t *testing.T) {
 			res := calculator.CalculateTax(
 				v.body,
-				config.Config{PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION})
+				config.Config{PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION, MaxKReceipt: config.DEFAULT_MAX_K_RECEIPT})
 			assert.Equal(t, v.expectedTax, res.Tax)
 		})
 	}
@@ -243,8 +275,9 @@ func TestCalculationHandler(t *testing.T) {
 				}})
 
 		err := stubHander.CalculateTaxHandler(c)
+		helper.ErrorHandler(err, c)
 
-		assert.NoError(t, err)
+		assert.Error(t, err)
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 
 		var response helper.ErrorResponse
@@ -263,8 +296,9 @@ func TestCalculationHandler(t *testing.T) {
 				}})
 
 		err := stubHander.CalculateTaxHandler(c)
+		helper.ErrorHandler(err, c)
 
-		assert.NoError(t, err)
+		assert.Error(t, err)
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 
 		var response helper.ErrorResponse
@@ -298,8 +332,9 @@ func TestCalculationHandler(t *testing.T) {
 				}})
 
 		err := stubHander.CalculateTaxHandler(c)
+		helper.ErrorHandler(err, c)
 
-		assert.NoError(t, err)
+		assert.Error(t, err)
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 
 		var response helper.ErrorResponse
@@ -329,6 +364,13 @@ func TestGetTaxLevel(t *testing.T) {
 		assert.LessOrEqual(t, 75000.0, taxLevels[2].Tax)
 		assert.LessOrEqual(t, 200000.0, taxLevels[3].Tax)
 	})
+
+	t.Run("Top level should show the tax on at most 2,000,000 of income", func(t *testing.T) {
+		taxLevels := calculator.GetTaxLevels(5000000)
+
+		assert.Equal(t, 700000.0, taxLevels[4].Tax)
+		assert.Equal(t, 1360000.0, calculator.GetTotalTax(5000000))
+	})
 }
 
 func TestCalculateTaxes(t *testing.T) {
@@ -393,3 +435,72 @@ func TestCalculateTaxes(t *testing.T) {
 		assert.Equal(t, expected, len(result))
 	})
 }
+
+func TestTotalTaxWithBrackets(t *testing.T) {
+	brackets := []config.TaxBracket{
+		{Level: "0-100,000", Min: 0, Max: 100000, Rate: 0},
+		{Level: "100,001 ขึ้นไป", Min: 100000, Rate: 0.5},
+	}
+
+	assert.Equal(t, 0.0, calculator.TotalTax(100000, brackets))
+	assert.Equal(t, 50000.0, calculator.TotalTax(200000, brackets))
+	assert.Equal(t, []calculator.TaxLevel{
+		{Level: "0-100,000", Tax: 0},
+		{Level: "100,001 ขึ้นไป", Tax: 50000},
+	}, calculator.TaxLevels(200000, brackets))
+}
+
+func TestBracketReached(t *testing.T) {
+	brackets := config.DefaultTaxBrackets()
+
+	assert.Equal(t, brackets[0].Level, calculator.BracketReached(-1000, brackets))
+	assert.Equal(t, brackets[0].Level, calculator.BracketReached(150000, brackets))
+	assert.Equal(t, brackets[1].Level, calculator.BracketReached(150001, brackets))
+	assert.Equal(t, brackets[4].Level, calculator.BracketReached(3000000, brackets))
+}
+
+func TestCalculateTaxUsesConfigVersion(t *testing.T) {
+	body := calculator.CalculateTaxBody{TotalIncome: 500000}
+	c := config.Config{
+		PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION,
+		TaxBrackets:       []config.TaxBracket{{Level: "flat", Rate: 0.1}},
+		Version:           7,
+	}
+
+	res := calculator.CalculateTax(body, c)
+
+	assert.Equal(t, 44000.0, res.Tax)
+	assert.Equal(t, int64(7), res.ConfigVersion)
+	assert.Equal(t, []calculator.TaxLevel{{Level: "flat", Tax: 44000}}, res.TaxLevel)
+}
+
+func TestCalculateTaxWithConfiguredCaps(t *testing.T) {
+	limits := config.DefaultLimits()
+	limits.MaxDonation = 20000
+	c := config.Config{PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION, MaxKReceipt: 10000, DeductionLimits: &limits}
+
+	t.Run("Donation should be capped by configured maximum", func(t *testing.T) {
+		res := calculator.CalculateTax(calculator.CalculateTaxBody{
+			TotalIncome: 500000,
+			Allowances:  []calculator.Allowance{{Type: "donation", Amount: 100000}},
+		}, c)
+
+		assert.Equal(t, 27000.0, res.Tax)
+	})
+
+	t.Run("K-Receipt should be capped by configured maximum", func(t *testing.T) {
+		res := calculator.CalculateTax(calculator.CalculateTaxBody{
+			TotalIncome: 500000,
+			Allowances:  []calculator.Allowance{{Type: "k-receipt", Amount: 50000}},
+		}, c)
+
+		assert.Equal(t, 28000.0, res.Tax)
+	})
+
+	t.Run("CSV donation should be capped by configured maximum", func(t *testing.T) {
+		wht, donation := 0.0, 100000.0
+		res := calculator.CalculateTaxes([]calculator.TaxCSV{{TotalIncome: 500000, WithHoldingTax: &wht, Donation: &donation}}, c)
+
+		assert.Equal(t, 27000.0, res[0].Tax)
+	})
+}
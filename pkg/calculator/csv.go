@@ -14,12 +14,15 @@ type TaxCSVInstance struct {
 
 func (ti TaxCSVInstance) Validate() error {
 	rows, err := gocsv.LazyCSVReader(ti.File).ReadAll()
-	if err != nil {
+	if err != nil || len(rows) == 0 {
 		return fmt.Errorf("wrong csv format")
 	}
 
 	header := rows[0]
 	expectedHeaders := []string{"totalIncome", "wht", "donation"}
+	if len(header) != len(expectedHeaders) {
+		return fmt.Errorf("wrong csv format")
+	}
 
 	for i, h := range header {
 		if h != expectedHeaders[i] {
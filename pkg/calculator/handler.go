@@ -1,76 +1,303 @@
 package calculator
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
-	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/middleware"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	cfg "github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/jaiieth/assessment-tax/pkg/tracing"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/jaiieth/assessment-tax/pkg/calculator")
+
 type Handler struct {
-	DB config.Database
+	DB      cfg.Database
+	History HistoryRepository
+	// Limiter enforces the daily CSV row quota of the client's API key.
+	Limiter *apikey.Limiter
 }
 
-func NewHandler(db config.Database) Handler {
+func NewHandler(db cfg.Database) Handler {
 	return Handler{DB: db}
 }
 
 func (h Handler) CalculateTaxHandler(c echo.Context) error {
 	var body CalculateTaxBody
 	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+		return helper.Invalid("invalid request", err)
 	}
 
 	if err := c.Validate(body); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+		return helper.Invalid("invalid request", err)
 	}
 
-	config, err := h.DB.GetConfig()
+	ctx := c.Request().Context()
+	config, err := h.getConfig(ctx, body.ConfigVersion, body.Date)
+	if errors.Is(err, cfg.ErrConfigVersionNotFound) || errors.Is(err, cfg.ErrNoConfigAt) {
+		return helper.Invalid(err.Error(), err)
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, helper.ErrorRes("Oops, something went wrong"))
+		return err
 	}
 
+	_, span := tracer.Start(ctx, "calculator.CalculateTax")
 	res := CalculateTax(body, config)
+	span.End()
+
+	id, err := h.record(ctx, CalculationType.Single, body, config, res)
+	if err != nil {
+		return err
+	}
+	res.CalculationID = id
+	observeCalculation(body, config, res)
+	res.TaxLevel = localizeLevels(i18n.FromContext(c), res.TaxLevel, config.Brackets())
 
 	return c.JSON(http.StatusOK, res)
 }
 
 func (h Handler) CalculateByCsvHandler(c echo.Context) error {
+	version, err := parseConfigVersion(c.FormValue("configVersion"))
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	date, err := parseDate(c.FormValue("date"))
+	if err != nil || (version != nil && date != nil) {
+		return helper.Invalid("invalid request", err)
+	}
+
 	file, err := c.FormFile("taxes.csv")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+		return helper.Invalid("invalid request", err)
 	}
 
 	src, err := file.Open()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+		return helper.Invalid("invalid request", err)
 	}
 	defer src.Close()
 
 	i := TaxCSVInstance{src}
+	ctx := c.Request().Context()
 
+	_, span := tracer.Start(ctx, "csv.validate")
 	err = i.Validate()
+	tracing.End(span, &err)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes(err.Error()))
+		return helper.Invalid(err.Error(), err)
 	}
 
 	var records []TaxCSV
-	if err := i.Unmarshal(&records); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+	_, span = tracer.Start(ctx, "csv.unmarshal")
+	err = i.Unmarshal(&records)
+	span.SetAttributes(attribute.Int("csv.rows", len(records)))
+	tracing.End(span, &err)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
 	}
 
-	for _, r := range records {
+	_, span = tracer.Start(ctx, "csv.validate_rows")
+	// Rows are numbered from 0, as if the file were a JSON array of rows.
+	rejected := 0
+	invalid := helper.ValidationError{}
+	for i, r := range records {
 		if err := c.Validate(r); err != nil {
-			return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+			rejected++
+			var verr helper.ValidationError
+			if errors.As(err, &verr) {
+				invalid = append(invalid, verr.At("/"+strconv.Itoa(i))...)
+			}
 		}
 	}
+	span.SetAttributes(attribute.Int("csv.rejected", rejected))
+	span.End()
+	if rejected > 0 {
+		metrics.CSVRows.WithLabelValues(metrics.CSVRow.Rejected).Add(float64(rejected))
+		return helper.Invalid("invalid request", invalid)
+	}
+
+	config, err := h.getConfig(ctx, version, date)
+	if errors.Is(err, cfg.ErrConfigVersionNotFound) || errors.Is(err, cfg.ErrNoConfigAt) {
+		return helper.Invalid(err.Error(), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The quota is only taken once the rows are sure to be calculated.
+	if k, ok := c.Get(middleware.ClientKey).(apikey.Key); ok && h.Limiter != nil {
+		if ok, retryAfter := h.Limiter.AllowRows(k, len(records)); !ok {
+			return helper.RateLimited("daily csv row quota exceeded", retryAfter)
+		}
+	}
+
+	_, span = tracer.Start(ctx, "csv.calculate", trace.WithAttributes(attribute.Int("csv.rows", len(records))))
+	res := CalculateByCSVResponse{Taxes: CalculateTaxes(records, config), ConfigVersion: config.Version}
+	span.End()
+
+	id, err := h.record(ctx, CalculationType.CSV, records, config, res)
+	if err != nil {
+		return err
+	}
+	res.CalculationID = id
+	observeCSV(records, config, res.Taxes)
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h Handler) GetCalculationHandler(c echo.Context) error {
+	if h.History == nil {
+		return helper.NotFound("calculation history is disabled", nil)
+	}
+
+	calc, err := h.History.GetCalculation(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, ErrCalculationNotFound) {
+		return helper.NotFound("calculation not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, calc)
+}
+
+func (h Handler) ListCalculationsHandler(c echo.Context) error {
+	if h.History == nil {
+		return helper.NotFound("calculation history is disabled", nil)
+	}
+
+	f, err := bindHistoryFilter(c)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	page, err := h.History.ListCalculations(c.Request().Context(), f)
+	if err != nil {
+		return err
+	}
 
-	config, err := h.DB.GetConfig()
+	return c.JSON(http.StatusOK, page)
+}
+
+// localizeLevels translates the labels of levels, which TaxLevels returns in
+// the order of brackets.
+func localizeLevels(lang string, levels []TaxLevel, brackets []cfg.TaxBracket) []TaxLevel {
+	localized := []TaxLevel{}
+	for i, l := range levels {
+		b := brackets[i]
+		l.Level = i18n.BracketLabel(lang, b.Level, b.Min, b.Max)
+		localized = append(localized, l)
+	}
+	return localized
+}
+
+// getConfig returns the pinned config version or the config effective at
+// the given date when one is given, otherwise the current config.
+func (h Handler) getConfig(ctx context.Context, version *int64, date *time.Time) (cfg.Config, error) {
+	if version != nil {
+		return h.DB.GetConfigVersion(ctx, *version)
+	}
+
+	c, err := h.resolveConfig(ctx, date)
+	if err != nil || c.Version != 0 {
+		return c, err
+	}
+
+	// Without a version, scheduled changes are due but not applied yet, or
+	// no config was saved. Saving them first gives the result a version it
+	// can be recalculated with.
+	if _, err := h.DB.ApplyScheduledChanges(ctx); err != nil {
+		return cfg.Config{}, err
+	}
+	return h.resolveConfig(ctx, date)
+}
+
+func (h Handler) resolveConfig(ctx context.Context, date *time.Time) (cfg.Config, error) {
+	if date != nil {
+		return h.DB.GetConfigAt(ctx, *date)
+	}
+	return h.DB.GetConfig(ctx)
+}
+
+func parseConfigVersion(v string) (*int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 1 {
+		return nil, errors.New("err: invalid config version")
+	}
+	return &version, nil
+}
+
+func parseDate(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, v)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, helper.ErrorRes("Oops, something went wrong"))
+		return nil, err
+	}
+	return &date, nil
+}
+
+// record stores the calculation when history is enabled and returns its ID.
+func (h Handler) record(ctx context.Context, t string, input interface{}, c cfg.Config, result interface{}) (string, error) {
+	if h.History == nil {
+		return "", nil
+	}
+
+	calc, err := NewCalculation(t, input, c, result)
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.History.SaveCalculation(ctx, calc); err != nil {
+		return "", err
+	}
+	return calc.ID, nil
+}
+
+func bindHistoryFilter(c echo.Context) (f HistoryFilter, err error) {
+	f.Type = c.QueryParam("type")
+	if f.Type != "" && f.Type != CalculationType.Single && f.Type != CalculationType.CSV {
+		return HistoryFilter{}, errors.New("err: invalid type")
+	}
+
+	if v := c.QueryParam("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return HistoryFilter{}, err
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return HistoryFilter{}, err
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return HistoryFilter{}, errors.New("err: invalid limit")
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return HistoryFilter{}, errors.New("err: invalid offset")
+		}
 	}
 
-	res := CalculateTaxes(records, config)
-	return c.JSON(http.StatusOK, CalculateByCSVResponse{Taxes: res})
+	return f, nil
 }
@@ -2,6 +2,7 @@ package calculator_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,32 +12,79 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/middleware"
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
 	calc "github.com/jaiieth/assessment-tax/pkg/calculator"
 	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockDB struct {
 	Config config.Config
 	Error  error
+	Date   time.Time
 	mock.Mock
 }
 
-func (m *mockDB) GetConfig() (config.Config, error) {
+func (m *mockDB) GetConfig(ctx context.Context) (config.Config, error) {
 	return m.Config, m.Error
 }
-func (m *mockDB) SetPersonalDeduction(n float64) (config.Config, error) {
-	m.Called(n)
-
+func (m *mockDB) GetConfigVersion(ctx context.Context, v int64) (config.Config, error) {
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	if v != m.Config.Version {
+		return config.Config{}, config.ErrConfigVersionNotFound
+	}
 	return m.Config, nil
 }
-func (m *mockDB) SetMaxKReceipt(n float64) (config.Config, error) {
-	m.Called()
-	return m.Config, nil
+func (m *mockDB) ListConfigVersions(ctx context.Context) ([]config.ConfigVersion, error) {
+	return []config.ConfigVersion{{Version: m.Config.Version, Config: m.Config}}, m.Error
+}
+func (m *mockDB) SetDeduction(context.Context, string, float64, config.Actor) (config.Config, error) {
+	return m.Config, m.Error
+}
+func (m *mockDB) SetLimits(context.Context, config.Limits, config.Actor) (config.Config, error) {
+	return m.Config, m.Error
+}
+func (m *mockDB) ReplaceConfig(ctx context.Context, c config.Config, a config.Actor) (config.Config, error) {
+	return c, m.Error
+}
+func (m *mockDB) PatchConfig(context.Context, json.RawMessage, config.Actor) (config.Config, error) {
+	return m.Config, m.Error
+}
+func (m *mockDB) ListAudit(context.Context, config.AuditFilter) (config.AuditPage, error) {
+	return config.AuditPage{}, m.Error
+}
+func (m *mockDB) GetConfigAt(ctx context.Context, t time.Time) (config.Config, error) {
+	m.Date = t
+	return m.Config, m.Error
+}
+func (m *mockDB) ScheduleChange(ctx context.Context, sc config.ScheduledChange, a config.Actor) (config.ScheduledChange, error) {
+	return sc, m.Error
+}
+func (m *mockDB) ListScheduledChanges(context.Context, string) ([]config.ScheduledChange, error) {
+	return []config.ScheduledChange{}, m.Error
+}
+func (m *mockDB) ApplyScheduledChanges(ctx context.Context) (config.Config, error) {
+	if m.Error == nil && m.Config.Version == 0 {
+		m.Config.Version = 1
+	}
+	return m.GetConfig(ctx)
+}
+func (m *mockDB) CancelScheduledChange(context.Context, int64, config.Actor) (config.ScheduledChange, error) {
+	return config.ScheduledChange{}, m.Error
 }
 
 func TestCalculateTaxHandler(t *testing.T) {
@@ -51,15 +99,15 @@ func TestCalculateTaxHandler(t *testing.T) {
 			t.Errorf("failed to marshal body: %v", err)
 		}
 
-		rec := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/calculate-tax", bytes.NewBuffer(bodyJSON))
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer(bodyJSON))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		e := echo.New()
 		e.Validator = helper.NewValidator()
 		c := e.NewContext(req, rec)
 
 		h := calc.NewHandler(&mockDB{})
-		h.CalculateTaxHandler(c)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
 
 		assert.Equal(t, http.StatusOK, rec.Code, fmt.Sprintf("status code should be %d but got %v", http.StatusOK, rec.Code))
 
@@ -75,15 +123,15 @@ func TestCalculateTaxHandler(t *testing.T) {
 		}
 		bodyJSON, _ := json.Marshal(body)
 
-		rec := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/calculate-tax", bytes.NewBuffer(bodyJSON))
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer(bodyJSON))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		e := echo.New()
 		e.Validator = helper.NewValidator()
 		c := e.NewContext(req, rec)
 
 		h := calc.NewHandler(&mockDB{})
-		h.CalculateTaxHandler(c)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
 		assert.Equal(t, http.StatusBadRequest, rec.Code, fmt.Sprintf("status code should be %d but got %v", http.StatusOK, rec.Code))
 	})
 
@@ -95,15 +143,15 @@ func TestCalculateTaxHandler(t *testing.T) {
 		}
 		bodyJSON, _ := json.Marshal(body)
 
-		rec := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/calculate-tax", bytes.NewBuffer(bodyJSON))
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer(bodyJSON))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		e := echo.New()
 		e.Validator = helper.NewValidator()
 		c := e.NewContext(req, rec)
 
 		h := calc.NewHandler(&mockDB{})
-		h.CalculateTaxHandler(c)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
 
 		var response helper.ErrorResponse
 		err := json.Unmarshal(rec.Body.Bytes(), &response)
@@ -113,15 +161,15 @@ func TestCalculateTaxHandler(t *testing.T) {
 	})
 
 	t.Run("TestInvalidRequestWithInvalidInput_InvalidJSONBody", func(t *testing.T) {
-		rec := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/calculate-tax", bytes.NewBuffer([]byte(`{Invalid}`)))
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer([]byte(`{Invalid}`)))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		e := echo.New()
 		e.Validator = helper.NewValidator()
 		c := e.NewContext(req, rec)
 
 		h := calc.NewHandler(&mockDB{})
-		h.CalculateTaxHandler(c)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
 
 		var response helper.ErrorResponse
 		err := json.Unmarshal(rec.Body.Bytes(), &response)
@@ -139,8 +187,8 @@ func TestErrorWhenUnableToRetrieveConfig(t *testing.T) {
 	}
 	bodyJSON, _ := json.Marshal(body)
 
-	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodPost, "/calculate-tax", bytes.NewBuffer(bodyJSON))
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	e := echo.New()
 	e.Validator = helper.NewValidator()
@@ -150,7 +198,7 @@ func TestErrorWhenUnableToRetrieveConfig(t *testing.T) {
 	h := calc.NewHandler(db)
 	h.DB = db
 
-	h.CalculateTaxHandler(c)
+	helper.ErrorHandler(h.CalculateTaxHandler(c), c)
 
 	var response helper.ErrorResponse
 	err := json.Unmarshal(rec.Body.Bytes(), &response)
@@ -200,13 +248,13 @@ func TestValidCSVFile(t *testing.T) {
 
 	e := echo.New()
 	e.Validator = helper.NewValidator()
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
 	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
 	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
 	c := e.NewContext(req, rec)
 
 	h := calc.NewHandler(&mockDB{})
-	h.CalculateByCsvHandler(c)
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
 
 	var res calc.CalculateByCSVResponse
 
@@ -255,7 +303,7 @@ func TestGetConfigError(t *testing.T) {
 
 	e := echo.New()
 	e.Validator = helper.NewValidator()
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
 	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
 	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
 	c := e.NewContext(req, rec)
@@ -265,7 +313,7 @@ func TestGetConfigError(t *testing.T) {
 	}
 
 	h := calc.NewHandler(stubDB)
-	h.CalculateByCsvHandler(c)
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
 
 	var res calc.CalculateByCSVResponse
 
@@ -285,13 +333,465 @@ func TestNoTaxesCSVFile(t *testing.T) {
 
 	e := echo.New()
 	e.Validator = helper.NewValidator()
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
 	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
 	c := e.NewContext(req, rec)
 
 	h := calc.NewHandler(&mockDB{})
-	h.CalculateByCsvHandler(c)
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code, "expected status code %d, got %d", http.StatusOK, rec.Code)
 }
+
+func TestCalculateTaxHandlerWithConfigVersion(t *testing.T) {
+	db := &mockDB{Config: config.Config{PersonalDeduction: 70000, Version: 2}}
+
+	t.Run("Pinned version should be used and returned", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(`{"totalIncome": 500000, "configVersion": 2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		var res calc.CalculateTaxResult
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 28000.0, res.Tax)
+		assert.Equal(t, int64(2), res.ConfigVersion)
+	})
+
+	t.Run("Unknown version should return 400", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(`{"totalIncome": 500000, "configVersion": 1}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		var res helper.ErrorResponse
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, "config version not found", res.Message)
+	})
+}
+
+func TestCalculateByCsvHandlerWithConfigVersion(t *testing.T) {
+	newRequest := func(version string) (echo.Context, *httptest.ResponseRecorder) {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		mw.WriteField("configVersion", version)
+		fw, err := mw.CreateFormFile("taxes.csv", "taxes.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("totalIncome,wht,donation\n500000,0,0\n"))
+		mw.Close()
+
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+		return e.NewContext(req, rec), rec
+	}
+
+	db := &mockDB{Config: config.Config{PersonalDeduction: 70000, Version: 2}}
+
+	t.Run("Pinned version should be used and returned", func(t *testing.T) {
+		c, rec := newRequest("2")
+
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		var res calc.CalculateByCSVResponse
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 28000.0, res.Taxes[0].Tax)
+		assert.Equal(t, int64(2), res.ConfigVersion)
+	})
+
+	t.Run("Unknown version should return 400", func(t *testing.T) {
+		c, rec := newRequest("5")
+
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Invalid version should return 400", func(t *testing.T) {
+		c, rec := newRequest("latest")
+
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestCalculateTaxHandlerWithDate(t *testing.T) {
+	t.Run("Config effective at date should be used", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(`{"totalIncome": 500000, "date": "2024-06-01T00:00:00+07:00"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Config: config.Config{PersonalDeduction: 70000, Version: 3}}
+		h := calc.NewHandler(db)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		var res calc.CalculateTaxResult
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 28000.0, res.Tax)
+		assert.True(t, time.Date(2024, 5, 31, 17, 0, 0, 0, time.UTC).Equal(db.Date))
+	})
+
+	t.Run("No config at date should return 400", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(`{"totalIncome": 500000, "date": "2000-01-01T00:00:00Z"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		h := calc.NewHandler(&mockDB{Error: config.ErrNoConfigAt})
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Date with configVersion should return 400", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(`{"totalIncome": 500000, "configVersion": 2, "date": "2024-06-01T00:00:00Z"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		h := calc.NewHandler(&mockDB{Config: config.Config{Version: 2}})
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestCalculateByCsvHandlerMetrics(t *testing.T) {
+	newRequest := func(csv string) (echo.Context, *httptest.ResponseRecorder) {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, err := mw.CreateFormFile("taxes.csv", "taxes.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(csv))
+		mw.Close()
+
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+		return e.NewContext(req, rec), rec
+	}
+	h := calc.NewHandler(&mockDB{Config: config.DefaultConfig()})
+
+	t.Run("Processed rows should be counted by result", func(t *testing.T) {
+		processed := testutil.ToFloat64(metrics.CSVRows.WithLabelValues(metrics.CSVRow.Processed))
+		refunds := testutil.ToFloat64(metrics.CalculationResults.WithLabelValues(calc.CalculationType.CSV, metrics.Result.Refund))
+		payments := testutil.ToFloat64(metrics.CalculationResults.WithLabelValues(calc.CalculationType.CSV, metrics.Result.Payment))
+
+		c, rec := newRequest("totalIncome,wht,donation\n500000,0,0\n500000,50000,0\n")
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, processed+2, testutil.ToFloat64(metrics.CSVRows.WithLabelValues(metrics.CSVRow.Processed)))
+		assert.Equal(t, refunds+1, testutil.ToFloat64(metrics.CalculationResults.WithLabelValues(calc.CalculationType.CSV, metrics.Result.Refund)))
+		assert.Equal(t, payments+1, testutil.ToFloat64(metrics.CalculationResults.WithLabelValues(calc.CalculationType.CSV, metrics.Result.Payment)))
+	})
+
+	t.Run("Invalid rows should be counted as rejected", func(t *testing.T) {
+		rejected := testutil.ToFloat64(metrics.CSVRows.WithLabelValues(metrics.CSVRow.Rejected))
+
+		c, rec := newRequest("totalIncome,wht,donation\n500000,600000,0\n500000,0,0\n400000,500000,0\n")
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, rejected+2, testutil.ToFloat64(metrics.CSVRows.WithLabelValues(metrics.CSVRow.Rejected)))
+	})
+}
+
+func TestCalculateByCsvHandlerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fw, err := mw.CreateFormFile("taxes.csv", "taxes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("totalIncome,wht,donation\n500000,0,0\n600000,0,0\n"))
+	mw.Close()
+
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+
+	h := calc.NewHandler(&mockDB{Config: config.DefaultConfig()})
+	c := e.NewContext(req, rec)
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+	var names []string
+	for _, s := range recorder.Ended() {
+		names = append(names, s.Name())
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"csv.validate", "csv.unmarshal", "csv.validate_rows", "csv.calculate"}, names)
+}
+
+func TestCalculateByCsvHandlerRowQuota(t *testing.T) {
+	newRequest := func() (echo.Context, *httptest.ResponseRecorder) {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, err := mw.CreateFormFile("taxes.csv", "taxes.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("totalIncome,wht,donation\n500000,0,0\n600000,0,0\n"))
+		mw.Close()
+
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+		c := e.NewContext(req, rec)
+		c.Set(middleware.ClientKey, apikey.Key{ID: 1, DailyRows: 3})
+		return c, rec
+	}
+
+	limiter := apikey.NewLimiter()
+	failing := calc.NewHandler(&mockDB{Error: errors.New("db error")})
+	failing.Limiter = limiter
+	h := calc.NewHandler(&mockDB{Config: config.Config{PersonalDeduction: 60000}})
+	h.Limiter = limiter
+
+	c, rec := newRequest()
+	helper.ErrorHandler(failing.CalculateByCsvHandler(c), c)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	c, rec = newRequest()
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+	assert.Equal(t, http.StatusOK, rec.Code, "a failed request should not use the quota")
+
+	c, rec = newRequest()
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+	var res helper.ErrorResponse
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "daily csv row quota exceeded", res.Message)
+}
+
+func TestCalculationValidationProblems(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	h := calc.NewHandler(&mockDB{Config: config.Config{PersonalDeduction: 60000}})
+
+	calculate := func(body string) helper.Problem {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		c := e.NewContext(req, rec)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		var p helper.Problem
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, helper.MIMEProblemJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		return p
+	}
+
+	t.Run("wht over totalIncome", func(t *testing.T) {
+		p := calculate(`{"totalIncome": 100000, "wht": 200000}`)
+
+		assert.Equal(t, helper.ValidationError{{
+			Pointer: "/wht", Rule: "ltefield", Limit: 100000.0,
+			Message: "wht must be less than or equal to totalIncome",
+		}}, p.Errors)
+	})
+
+	t.Run("Duplicate allowance types", func(t *testing.T) {
+		p := calculate(`{"totalIncome": 100000, "allowances": [
+			{"allowanceType": "donation", "amount": 100},
+			{"allowanceType": "donation", "amount": 200}
+		]}`)
+
+		assert.Equal(t, helper.ValidationError{{
+			Pointer: "/allowances", Rule: "unique",
+			Message: "allowances must not contain duplicate allowanceType",
+		}}, p.Errors)
+	})
+
+	t.Run("Wrong JSON type", func(t *testing.T) {
+		p := calculate(`{"totalIncome": "500000"}`)
+
+		assert.Equal(t, "/totalIncome", p.Errors[0].Pointer)
+		assert.Equal(t, "type", p.Errors[0].Rule)
+	})
+
+	t.Run("Invalid CSV rows", func(t *testing.T) {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("taxes.csv", "taxes.csv")
+		fw.Write([]byte("totalIncome,wht,donation\n500000,0,0\n100000,200000,-1\n"))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+
+		c := e.NewContext(req, rec)
+
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		var p helper.Problem
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Len(t, p.Errors, 2)
+		assert.Equal(t, "/1/wht", p.Errors[0].Pointer)
+		assert.Equal(t, "/1/donation", p.Errors[1].Pointer)
+	})
+}
+
+func TestCalculateTaxHandlerLocalized(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	h := calc.NewHandler(&mockDB{Config: config.Config{PersonalDeduction: 60000}})
+
+	calculate := func(lang string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Accept-Language", lang)
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		c := e.NewContext(req, rec)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+		return rec
+	}
+
+	for lang, want := range map[string]struct {
+		level   string
+		message string
+		detail  string
+	}{
+		"th": {"2,000,001 ขึ้นไป", "wht ต้องน้อยกว่าหรือเท่ากับ totalIncome", "คำขอไม่ถูกต้อง"},
+		"en": {"2,000,001 and above", "wht must be less than or equal to totalIncome", "invalid request"},
+	} {
+		t.Run(lang, func(t *testing.T) {
+			rec := calculate(lang, `{"totalIncome": 500000}`)
+			var res calc.CalculateTaxResult
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, "150,001-500,000", res.TaxLevel[1].Level)
+			assert.Equal(t, want.level, res.TaxLevel[4].Level)
+
+			rec = calculate(lang, `{"totalIncome": 100, "wht": 200}`)
+			var p helper.Problem
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, want.detail, p.Detail)
+			assert.Equal(t, want.message, p.Errors[0].Message)
+		})
+	}
+}
+
+func TestCalculateByCsvHandlerLocalized(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	h := calc.NewHandler(&mockDB{Config: config.DefaultConfig()})
+
+	upload := func(lang string, csv string) helper.Problem {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		fw, _ := mw.CreateFormFile("taxes.csv", "taxes.csv")
+		fw.Write([]byte(csv))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations/upload-csv", &b)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+		req.Header.Set("Accept-Language", lang)
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations/upload-csv")
+		c := e.NewContext(req, rec)
+		helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+		var p helper.Problem
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		return p
+	}
+
+	for lang, want := range map[string]string{
+		"th": "รูปแบบไฟล์ CSV ไม่ถูกต้อง",
+		"en": "wrong csv format",
+	} {
+		t.Run(lang, func(t *testing.T) {
+			assert.Equal(t, want, upload(lang, "income,wht,donation\n500000,0,0\n").Detail)
+			assert.Equal(t, want, upload(lang, "totalIncome,wht\n500000,0\n").Detail)
+			assert.Equal(t, want, upload(lang, "").Detail)
+		})
+	}
+}
+
+func TestCalculateTaxHandlerConfigVersion(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	admin := config.Actor{Username: "adminTax"}
+
+	calculate := func(h calc.Handler, body string) calc.CalculateTaxResult {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/tax/calculations")
+		c := e.NewContext(req, rec)
+		helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+		var res calc.CalculateTaxResult
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res
+	}
+
+	t.Run("Due scheduled change should be applied first", func(t *testing.T) {
+		db := config.NewMemory()
+		_, err := db.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"personalDeduction":70000}`), EffectiveFrom: time.Now().Add(-time.Minute)}, admin)
+		assert.NoError(t, err)
+
+		res := calculate(calc.NewHandler(db), `{"totalIncome": 500000}`)
+
+		assert.Equal(t, int64(2), res.ConfigVersion)
+		assert.Equal(t, 28000.0, res.Tax)
+		c, _ := db.GetConfigVersion(context.Background(), 2)
+		assert.Equal(t, 70000.0, c.PersonalDeduction)
+	})
+
+	t.Run("Future date should report the version it was projected from", func(t *testing.T) {
+		db := config.NewMemory()
+		_, err := db.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"personalDeduction":70000}`), EffectiveFrom: time.Now().Add(time.Hour)}, admin)
+		assert.NoError(t, err)
+
+		date := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
+		res := calculate(calc.NewHandler(db), `{"totalIncome": 500000, "date": "`+date+`"}`)
+
+		assert.Equal(t, int64(1), res.ConfigVersion)
+		assert.Equal(t, 28000.0, res.Tax)
+	})
+}
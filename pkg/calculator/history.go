@@ -0,0 +1,203 @@
+package calculator
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/config"
+)
+
+var ErrCalculationNotFound = errors.New("calculation not found")
+
+var CalculationType = struct {
+	Single string
+	CSV    string
+}{
+	Single: "single",
+	CSV:    "csv",
+}
+
+const (
+	DEFAULT_HISTORY_LIMIT = 20
+	MAX_HISTORY_LIMIT     = 100
+)
+
+type Calculation struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Input     json.RawMessage `json:"input"`
+	Config    config.Config   `json:"config"`
+	Result    json.RawMessage `json:"result"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type HistoryFilter struct {
+	Type   string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+type HistoryPage struct {
+	Calculations []Calculation `json:"calculations"`
+	Total        int           `json:"total"`
+	Limit        int           `json:"limit"`
+	Offset       int           `json:"offset"`
+}
+
+type HistoryRepository interface {
+	SaveCalculation(context.Context, Calculation) error
+	GetCalculation(ctx context.Context, id string) (Calculation, error)
+	ListCalculations(context.Context, HistoryFilter) (HistoryPage, error)
+}
+
+// NewHistoryRepository picks the store from HISTORY_STORE. History is opt-in,
+// so an empty value returns a nil repository and nothing is recorded. db is
+// nil when the config store is not Postgres, and timeout bounds every call to
+// the Postgres store like config.Postgres.Timeout.
+func NewHistoryRepository(db *sql.DB, timeout time.Duration) (HistoryRepository, error) {
+	switch store := os.Getenv("HISTORY_STORE"); store {
+	case "":
+		return nil, nil
+	case "postgres":
+		if db == nil {
+			return nil, errors.New("err: HISTORY_STORE postgres needs the postgres CONFIG_STORE")
+		}
+		return &PostgresHistory{Db: db, Timeout: timeout}, nil
+	case "memory":
+		return NewMemoryHistory(), nil
+	default:
+		return nil, fmt.Errorf("err: unknown HISTORY_STORE %q", store)
+	}
+}
+
+func NewCalculation(t string, input interface{}, c config.Config, result interface{}) (Calculation, error) {
+	id, err := newCalculationID()
+	if err != nil {
+		return Calculation{}, err
+	}
+
+	in, err := json.Marshal(input)
+	if err != nil {
+		return Calculation{}, err
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		return Calculation{}, err
+	}
+
+	return Calculation{
+		ID:        id,
+		Type:      t,
+		Input:     in,
+		Config:    c,
+		Result:    res,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// newCalculationID returns a random RFC 4122 version 4 UUID.
+func newCalculationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]), nil
+}
+
+func (f HistoryFilter) normalize() HistoryFilter {
+	if f.Limit <= 0 {
+		f.Limit = DEFAULT_HISTORY_LIMIT
+	}
+	if f.Limit > MAX_HISTORY_LIMIT {
+		f.Limit = MAX_HISTORY_LIMIT
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return f
+}
+
+func (f HistoryFilter) match(c Calculation) bool {
+	if f.Type != "" && c.Type != f.Type {
+		return false
+	}
+	if !f.From.IsZero() && c.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && c.CreatedAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+type MemoryHistory struct {
+	mu           sync.RWMutex
+	calculations map[string]Calculation
+}
+
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{calculations: map[string]Calculation{}}
+}
+
+func (m *MemoryHistory) SaveCalculation(ctx context.Context, c Calculation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calculations[c.ID] = c
+	return nil
+}
+
+func (m *MemoryHistory) GetCalculation(ctx context.Context, id string) (Calculation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.calculations[id]
+	if !ok {
+		return Calculation{}, ErrCalculationNotFound
+	}
+	return c, nil
+}
+
+func (m *MemoryHistory) ListCalculations(ctx context.Context, f HistoryFilter) (HistoryPage, error) {
+	f = f.normalize()
+
+	m.mu.RLock()
+	matched := []Calculation{}
+	for _, c := range m.calculations {
+		if f.match(c) {
+			matched = append(matched, c)
+		}
+	}
+	m.mu.RUnlock()
+
+	// Newest first, same as the Postgres implementation
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].ID > matched[j].ID
+		}
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	page := HistoryPage{Calculations: []Calculation{}, Total: len(matched), Limit: f.Limit, Offset: f.Offset}
+	if f.Offset < len(matched) {
+		end := min(f.Offset+f.Limit, len(matched))
+		page.Calculations = matched[f.Offset:end]
+	}
+	return page, nil
+}
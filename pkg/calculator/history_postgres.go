@@ -0,0 +1,144 @@
+package calculator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type PostgresHistory struct {
+	Db *sql.DB
+	// Timeout bounds every method call. Zero means no timeout other than the
+	// caller's.
+	Timeout time.Duration
+}
+
+// withTimeout works like config.Postgres.withTimeout: errors after ctx is
+// done are wrapped with ctx.Err().
+func (p *PostgresHistory) withTimeout(ctx context.Context) (context.Context, func(*error)) {
+	cancel := func() {}
+	if p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil && !errors.Is(*err, ctx.Err()) {
+			*err = fmt.Errorf("%w: %v", ctx.Err(), *err)
+		}
+		cancel()
+	}
+}
+
+func (p *PostgresHistory) SaveCalculation(ctx context.Context, c Calculation) (err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	cfg, err := json.Marshal(c.Config)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Db.ExecContext(ctx,
+		"INSERT INTO calculations (id, type, input, config, result, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		c.ID, c.Type, []byte(c.Input), cfg, []byte(c.Result), c.CreatedAt,
+	)
+	return err
+}
+
+func (p *PostgresHistory) GetCalculation(ctx context.Context, id string) (_ Calculation, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	row := p.Db.QueryRowContext(ctx, "SELECT id, type, input, config, result, created_at FROM calculations WHERE id = $1", id)
+
+	c, err := scanCalculation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Calculation{}, ErrCalculationNotFound
+	}
+	if err != nil {
+		return Calculation{}, err
+	}
+	return c, nil
+}
+
+func (p *PostgresHistory) ListCalculations(ctx context.Context, f HistoryFilter) (_ HistoryPage, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	f = f.normalize()
+
+	where, args := historyWhere(f)
+
+	page := HistoryPage{Calculations: []Calculation{}, Limit: f.Limit, Offset: f.Offset}
+	if err := p.Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM calculations"+where, args...).Scan(&page.Total); err != nil {
+		return HistoryPage{}, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, type, input, config, result, created_at FROM calculations%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d",
+		where, len(args)+1, len(args)+2,
+	)
+	rows, err := p.Db.QueryContext(ctx, query, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCalculation(rows)
+		if err != nil {
+			return HistoryPage{}, err
+		}
+		page.Calculations = append(page.Calculations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return HistoryPage{}, err
+	}
+
+	return page, nil
+}
+
+func historyWhere(f HistoryFilter) (string, []interface{}) {
+	conds := []string{}
+	args := []interface{}{}
+
+	if f.Type != "" {
+		args = append(args, f.Type)
+		conds = append(conds, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conds = append(conds, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conds = append(conds, fmt.Sprintf("created_at <= $%d", len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCalculation(s scanner) (c Calculation, err error) {
+	var input, cfg, result []byte
+	if err = s.Scan(&c.ID, &c.Type, &input, &cfg, &result, &c.CreatedAt); err != nil {
+		return Calculation{}, err
+	}
+
+	if err = json.Unmarshal(cfg, &c.Config); err != nil {
+		return Calculation{}, err
+	}
+	c.Input = input
+	c.Result = result
+
+	return c, nil
+}
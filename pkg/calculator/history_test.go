@@ -0,0 +1,367 @@
+package calculator_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/helper"
+	calc "github.com/jaiieth/assessment-tax/pkg/calculator"
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStoredCalculation(t *testing.T, typ string, createdAt time.Time) calc.Calculation {
+	c, err := calc.NewCalculation(typ, map[string]float64{"totalIncome": 500000}, config.Config{PersonalDeduction: 60000}, map[string]float64{"tax": 29000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreatedAt = createdAt
+	return c
+}
+
+func TestNewHistoryRepository(t *testing.T) {
+	t.Run("Disabled by default", func(t *testing.T) {
+		os.Unsetenv("HISTORY_STORE")
+
+		r, err := calc.NewHistoryRepository(nil, 0)
+
+		assert.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		t.Setenv("HISTORY_STORE", "memory")
+
+		r, err := calc.NewHistoryRepository(nil, 0)
+
+		assert.NoError(t, err)
+		assert.IsType(t, &calc.MemoryHistory{}, r)
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		t.Setenv("HISTORY_STORE", "postgres")
+
+		r, err := calc.NewHistoryRepository(&sql.DB{}, 0)
+
+		assert.NoError(t, err)
+		assert.IsType(t, &calc.PostgresHistory{}, r)
+	})
+
+	t.Run("Unknown store", func(t *testing.T) {
+		t.Setenv("HISTORY_STORE", "redis")
+
+		_, err := calc.NewHistoryRepository(nil, 0)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestNewCalculation(t *testing.T) {
+	c, err := calc.NewCalculation(calc.CalculationType.Single, calc.CalculateTaxBody{TotalIncome: 500000}, config.Config{PersonalDeduction: 60000, Version: 1}, calc.CalculateTaxResult{Tax: 29000, ConfigVersion: 1})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, c.ID)
+	assert.Equal(t, calc.CalculationType.Single, c.Type)
+	assert.JSONEq(t, `{"totalIncome":500000,"wht":0,"allowances":null}`, string(c.Input))
+	assert.JSONEq(t, `{"tax":29000,"configVersion":1}`, string(c.Result))
+	assert.Equal(t, 60000.0, c.Config.PersonalDeduction)
+	assert.False(t, c.CreatedAt.IsZero())
+}
+
+func TestMemoryHistory(t *testing.T) {
+	now := time.Now().UTC()
+
+	t.Run("Save and get", func(t *testing.T) {
+		m := calc.NewMemoryHistory()
+		c := newStoredCalculation(t, calc.CalculationType.Single, now)
+
+		assert.NoError(t, m.SaveCalculation(context.Background(), c))
+
+		got, err := m.GetCalculation(context.Background(), c.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, c, got)
+	})
+
+	t.Run("Get unknown ID should return not found", func(t *testing.T) {
+		m := calc.NewMemoryHistory()
+
+		_, err := m.GetCalculation(context.Background(), "unknown")
+
+		assert.ErrorIs(t, err, calc.ErrCalculationNotFound)
+	})
+
+	t.Run("List should filter, sort newest first and paginate", func(t *testing.T) {
+		m := calc.NewMemoryHistory()
+		oldest := newStoredCalculation(t, calc.CalculationType.Single, now.Add(-3*time.Hour))
+		middle := newStoredCalculation(t, calc.CalculationType.CSV, now.Add(-2*time.Hour))
+		newest := newStoredCalculation(t, calc.CalculationType.Single, now.Add(-1*time.Hour))
+		for _, c := range []calc.Calculation{oldest, middle, newest} {
+			m.SaveCalculation(context.Background(), c)
+		}
+
+		page, err := m.ListCalculations(context.Background(), calc.HistoryFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, page.Total)
+		assert.Equal(t, calc.DEFAULT_HISTORY_LIMIT, page.Limit)
+		assert.Equal(t, []calc.Calculation{newest, middle, oldest}, page.Calculations)
+
+		page, _ = m.ListCalculations(context.Background(), calc.HistoryFilter{Type: calc.CalculationType.Single})
+		assert.Equal(t, []calc.Calculation{newest, oldest}, page.Calculations)
+
+		page, _ = m.ListCalculations(context.Background(), calc.HistoryFilter{From: now.Add(-150 * time.Minute), To: now.Add(-90 * time.Minute)})
+		assert.Equal(t, []calc.Calculation{middle}, page.Calculations)
+
+		page, _ = m.ListCalculations(context.Background(), calc.HistoryFilter{Limit: 1, Offset: 1})
+		assert.Equal(t, 3, page.Total)
+		assert.Equal(t, []calc.Calculation{middle}, page.Calculations)
+
+		page, _ = m.ListCalculations(context.Background(), calc.HistoryFilter{Offset: 10})
+		assert.Equal(t, []calc.Calculation{}, page.Calculations)
+	})
+}
+
+func TestPostgresHistory(t *testing.T) {
+	columns := []string{"id", "type", "input", "config", "result", "created_at"}
+	createdAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("SaveCalculation", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		c := newStoredCalculation(t, calc.CalculationType.Single, createdAt)
+		mock.ExpectExec("INSERT INTO calculations").
+			WithArgs(c.ID, c.Type, []byte(c.Input), sqlmock.AnyArg(), []byte(c.Result), c.CreatedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		p := &calc.PostgresHistory{Db: db}
+
+		assert.NoError(t, p.SaveCalculation(context.Background(), c))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetCalculation", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM calculations WHERE id").WithArgs("abc").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", "single", []byte(`{"totalIncome":1}`), []byte(`{"personalDeduction":60000}`), []byte(`{"tax":0}`), createdAt))
+
+		p := &calc.PostgresHistory{Db: db}
+
+		c, err := p.GetCalculation(context.Background(), "abc")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", c.ID)
+		assert.Equal(t, 60000.0, c.Config.PersonalDeduction)
+		assert.JSONEq(t, `{"tax":0}`, string(c.Result))
+	})
+
+	t.Run("Slow query should time out", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		c := newStoredCalculation(t, calc.CalculationType.Single, createdAt)
+		mock.ExpectExec("INSERT INTO calculations").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		p := &calc.PostgresHistory{Db: db, Timeout: 10 * time.Millisecond}
+
+		assert.ErrorIs(t, p.SaveCalculation(context.Background(), c), context.DeadlineExceeded)
+	})
+
+	t.Run("GetCalculation not found", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM calculations WHERE id").WillReturnError(sql.ErrNoRows)
+
+		p := &calc.PostgresHistory{Db: db}
+
+		_, err = p.GetCalculation(context.Background(), "abc")
+
+		assert.ErrorIs(t, err, calc.ErrCalculationNotFound)
+	})
+
+	t.Run("ListCalculations with filters", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		from := createdAt.Add(-time.Hour)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM calculations WHERE type = $1 AND created_at >= $2")).
+			WithArgs("csv", from).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM calculations WHERE type = $1 AND created_at >= $2 ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4")).
+			WithArgs("csv", from, 5, 10).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("abc", "csv", []byte(`[]`), []byte(`{}`), []byte(`{"taxes":[]}`), createdAt))
+
+		p := &calc.PostgresHistory{Db: db}
+
+		page, err := p.ListCalculations(context.Background(), calc.HistoryFilter{Type: "csv", From: from, Limit: 5, Offset: 10})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 11, page.Total)
+		assert.Len(t, page.Calculations, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetCalculationHandler(t *testing.T) {
+	t.Run("History disabled should return 404", func(t *testing.T) {
+		c, rec := NewContext(http.MethodGet, "/admin/calculations/abc", nil)
+		c.SetParamNames("id")
+		c.SetParamValues("abc")
+
+		h := calc.NewHandler(&mockDB{})
+		helper.ErrorHandler(h.GetCalculationHandler(c), c)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Recorded calculation can be retrieved by ID", func(t *testing.T) {
+		history := calc.NewMemoryHistory()
+		stored := newStoredCalculation(t, calc.CalculationType.Single, time.Now().UTC())
+		history.SaveCalculation(context.Background(), stored)
+
+		c, rec := NewContext(http.MethodGet, "/admin/calculations/"+stored.ID, nil)
+		c.SetParamNames("id")
+		c.SetParamValues(stored.ID)
+
+		h := calc.NewHandler(&mockDB{})
+		h.History = history
+		helper.ErrorHandler(h.GetCalculationHandler(c), c)
+
+		var res calc.Calculation
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, stored.ID, res.ID)
+	})
+
+	t.Run("Unknown ID should return 404", func(t *testing.T) {
+		c, rec := NewContext(http.MethodGet, "/admin/calculations/unknown", nil)
+		c.SetParamNames("id")
+		c.SetParamValues("unknown")
+
+		h := calc.NewHandler(&mockDB{})
+		h.History = calc.NewMemoryHistory()
+		helper.ErrorHandler(h.GetCalculationHandler(c), c)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestListCalculationsHandler(t *testing.T) {
+	history := calc.NewMemoryHistory()
+	history.SaveCalculation(context.Background(), newStoredCalculation(t, calc.CalculationType.Single, time.Now().UTC()))
+	history.SaveCalculation(context.Background(), newStoredCalculation(t, calc.CalculationType.CSV, time.Now().UTC()))
+
+	t.Run("Should filter and paginate", func(t *testing.T) {
+		c, rec := NewContext(http.MethodGet, "/admin/calculations?type=csv&limit=1&offset=0", nil)
+
+		h := calc.NewHandler(&mockDB{})
+		h.History = history
+		helper.ErrorHandler(h.ListCalculationsHandler(c), c)
+
+		var res calc.HistoryPage
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 1, res.Total)
+		assert.Equal(t, 1, res.Limit)
+		assert.Equal(t, calc.CalculationType.CSV, res.Calculations[0].Type)
+	})
+
+	for _, query := range []string{"type=unknown", "from=yesterday", "to=2024-13-01", "limit=0", "limit=abc", "offset=-1"} {
+		t.Run("Invalid query "+query+" should return 400", func(t *testing.T) {
+			c, rec := NewContext(http.MethodGet, "/admin/calculations?"+query, nil)
+
+			h := calc.NewHandler(&mockDB{})
+			h.History = history
+			helper.ErrorHandler(h.ListCalculationsHandler(c), c)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	t.Run("History disabled should return 404", func(t *testing.T) {
+		c, rec := NewContext(http.MethodGet, "/admin/calculations", nil)
+
+		h := calc.NewHandler(&mockDB{})
+		helper.ErrorHandler(h.ListCalculationsHandler(c), c)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestCalculateTaxHandlerRecordsHistory(t *testing.T) {
+	c, rec := NewContext(http.MethodPost, "/tax/calculations", strings.NewReader(`{"totalIncome": 500000.0, "wht": 0.0}`))
+	c.Request().Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	history := calc.NewMemoryHistory()
+	h := calc.NewHandler(&mockDB{Config: config.Config{PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION}})
+	h.History = history
+	helper.ErrorHandler(h.CalculateTaxHandler(c), c)
+
+	var res calc.CalculateTaxResult
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.NotEmpty(t, res.CalculationID)
+
+	stored, err := history.GetCalculation(context.Background(), res.CalculationID)
+	assert.NoError(t, err)
+	assert.Equal(t, calc.CalculationType.Single, stored.Type)
+	assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, stored.Config.PersonalDeduction)
+	assert.JSONEq(t, `{"totalIncome":500000,"wht":0,"allowances":null}`, string(stored.Input))
+}
+
+func TestCalculateByCsvHandlerRecordsHistory(t *testing.T) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fw, err := mw.CreateFormFile("taxes.csv", "taxes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("totalIncome,wht,donation\n500000,0,0\n"))
+	mw.Close()
+
+	c, rec := NewContext(http.MethodPost, "/tax/calculations/upload-csv", &b)
+	c.Request().Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+
+	history := calc.NewMemoryHistory()
+	h := calc.NewHandler(&mockDB{Config: config.Config{PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION}})
+	h.History = history
+	helper.ErrorHandler(h.CalculateByCsvHandler(c), c)
+
+	var res calc.CalculateByCSVResponse
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+
+	stored, err := history.GetCalculation(context.Background(), res.CalculationID)
+	assert.NoError(t, err)
+	assert.Equal(t, calc.CalculationType.CSV, stored.Type)
+	assert.JSONEq(t, `[{"totalIncome":500000,"wht":0,"donation":0}]`, string(stored.Input))
+	assert.JSONEq(t, `{"taxes":[{"totalIncome":500000,"tax":29000}],"configVersion":1}`, string(stored.Result))
+}
@@ -0,0 +1,19 @@
+package calculator
+
+import (
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+)
+
+func observeCalculation(b CalculateTaxBody, c config.Config, res CalculateTaxResult) {
+	metrics.Calculations.WithLabelValues(CalculationType.Single, BracketReached(b.taxable(c), c.Brackets())).Inc()
+	metrics.CalculationResults.WithLabelValues(CalculationType.Single, metrics.ResultOf(res.Tax, res.TaxRefund)).Inc()
+}
+
+func observeCSV(rs []TaxCSV, c config.Config, res []CalculateByCSVResponseItem) {
+	for i, r := range rs {
+		metrics.Calculations.WithLabelValues(CalculationType.CSV, BracketReached(r.taxable(c), c.Brackets())).Inc()
+		metrics.CalculationResults.WithLabelValues(CalculationType.CSV, metrics.ResultOf(res[i].Tax, res[i].TaxRefund)).Inc()
+	}
+	metrics.CSVRows.WithLabelValues(metrics.CSVRow.Processed).Add(float64(len(rs)))
+}
@@ -2,7 +2,14 @@ package calculator
 
 import "github.com/labstack/echo/v4"
 
-func (h Handler) RegisterRoutes(e *echo.Echo) {
-	e.POST("/tax/calculations", h.CalculateTaxHandler)
-	e.POST("/tax/calculations/upload-csv", h.CalculateByCsvHandler)
+func (h Handler) RegisterRoutes(e *echo.Echo, m ...echo.MiddlewareFunc) {
+	e.POST("/tax/calculations", h.CalculateTaxHandler, m...)
+	e.POST("/tax/calculations/upload-csv", h.CalculateByCsvHandler, m...)
+}
+
+// RegisterAdminRoutes registers the calculation history, which holds
+// taxpayer data and is only for admins.
+func (h Handler) RegisterAdminRoutes(e *echo.Group) {
+	e.GET("/calculations", h.ListCalculationsHandler)
+	e.GET("/calculations/:id", h.GetCalculationHandler)
 }
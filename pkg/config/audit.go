@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_AUDIT_LIMIT = 50
+	MAX_AUDIT_LIMIT     = 500
+)
+
+// Actor identifies who made a config change, for the audit log.
+type Actor struct {
+	Username  string
+	RequestID string
+}
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Username  string          `json:"username"`
+	Field     string          `json:"field"`
+	OldValue  json.RawMessage `json:"oldValue"`
+	NewValue  json.RawMessage `json:"newValue"`
+	Version   int64           `json:"version"`
+	RequestID string          `json:"requestId,omitempty"`
+	ChangedAt time.Time       `json:"changedAt"`
+}
+
+type AuditFilter struct {
+	Field  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+func (f AuditFilter) normalize() AuditFilter {
+	if f.Limit <= 0 {
+		f.Limit = DEFAULT_AUDIT_LIMIT
+	}
+	if f.Limit > MAX_AUDIT_LIMIT {
+		f.Limit = MAX_AUDIT_LIMIT
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return f
+}
+
+// diffConfig returns one audit entry per JSON field that differs between the
+// old and new config, so new config fields are audited without extra code.
+func diffConfig(old Config, new Config, a Actor) ([]AuditEntry, error) {
+	old.Version, new.Version = 0, 0
+
+	oldFields, err := configFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := configFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range newFields {
+		names = append(names, name)
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entries := []AuditEntry{}
+	for _, name := range names {
+		o, n := jsonOrNull(oldFields[name]), jsonOrNull(newFields[name])
+		if bytes.Equal(o, n) {
+			continue
+		}
+		entries = append(entries, AuditEntry{
+			Username:  a.Username,
+			Field:     name,
+			OldValue:  o,
+			NewValue:  n,
+			RequestID: a.RequestID,
+		})
+	}
+	return entries, nil
+}
+
+func configFields(c Config) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func jsonOrNull(v json.RawMessage) json.RawMessage {
+	if v == nil {
+		return json.RawMessage("null")
+	}
+	return v
+}
+
+func insertAudit(ctx context.Context, tx *sql.Tx, entries []AuditEntry, version int64) error {
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO config_audit (username, field, old_value, new_value, version, request_id) VALUES ($1, $2, $3, $4, $5, $6)",
+			e.Username, e.Field, []byte(e.OldValue), []byte(e.NewValue), version, e.RequestID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) ListAudit(ctx context.Context, f AuditFilter) (_ AuditPage, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	f = f.normalize()
+
+	where, args := auditWhere(f)
+
+	page := AuditPage{Entries: []AuditEntry{}, Limit: f.Limit, Offset: f.Offset}
+	if err := p.Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM config_audit"+where, args...).Scan(&page.Total); err != nil {
+		return AuditPage{}, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, username, field, old_value, new_value, version, request_id, changed_at FROM config_audit%s ORDER BY changed_at DESC, id DESC LIMIT $%d OFFSET $%d",
+		where, len(args)+1, len(args)+2,
+	)
+	rows, err := p.Db.QueryContext(ctx, query, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return AuditPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var o, n []byte
+		if err := rows.Scan(&e.ID, &e.Username, &e.Field, &o, &n, &e.Version, &e.RequestID, &e.ChangedAt); err != nil {
+			return AuditPage{}, err
+		}
+		e.OldValue, e.NewValue = o, n
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return AuditPage{}, err
+	}
+
+	return page, nil
+}
+
+func auditWhere(f AuditFilter) (string, []interface{}) {
+	conds := []string{}
+	args := []interface{}{}
+
+	if f.Field != "" {
+		args = append(args, f.Field)
+		conds = append(conds, fmt.Sprintf("field = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conds = append(conds, fmt.Sprintf("changed_at >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conds = append(conds, fmt.Sprintf("changed_at <= $%d", len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
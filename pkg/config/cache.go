@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache is a Database that keeps the current config for up to TTL. Writes
+// through the cache drop it; writes by other instances are picked up through
+// Invalidate, called by Listen. The config is never kept past the time the
+// next scheduled change takes effect.
+type Cache struct {
+	Database
+	TTL time.Duration
+
+	mu         sync.Mutex
+	config     *Config
+	expires    time.Time
+	generation int64
+	versions   map[int64]Config
+}
+
+func NewCache(db Database, ttl time.Duration) *Cache {
+	return &Cache{Database: db, TTL: ttl, versions: map[int64]Config{}}
+}
+
+// Invalidate drops the cached config, so the next read loads it again.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.config = nil
+	c.generation++
+}
+
+func (c *Cache) GetConfig(ctx context.Context) (Config, error) {
+	c.mu.Lock()
+	if c.config != nil && time.Now().Before(c.expires) {
+		cfg := c.config.clone()
+		c.mu.Unlock()
+		return cfg, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	loadedAt := time.Now()
+	cfg, err := c.Database.GetConfig(ctx)
+	if err != nil {
+		return Config{}, err
+	}
+	pending, err := c.Database.ListScheduledChanges(ctx, ScheduleStatus.Pending)
+	if err != nil {
+		return Config{}, err
+	}
+
+	expires := loadedAt.Add(c.TTL)
+	for _, sc := range pending {
+		if sc.EffectiveFrom.Before(expires) {
+			expires = sc.EffectiveFrom
+		}
+	}
+
+	c.mu.Lock()
+	// A config loaded while it was being changed may already be stale.
+	if generation == c.generation {
+		stored := cfg.clone()
+		c.config, c.expires = &stored, expires
+	}
+	c.mu.Unlock()
+
+	return cfg, nil
+}
+
+// GetConfigVersion caches versions for good, since they never change.
+func (c *Cache) GetConfigVersion(ctx context.Context, version int64) (Config, error) {
+	c.mu.Lock()
+	cfg, ok := c.versions[version]
+	c.mu.Unlock()
+	if ok {
+		return cfg.clone(), nil
+	}
+
+	cfg, err := c.Database.GetConfigVersion(ctx, version)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c.mu.Lock()
+	c.versions[version] = cfg.clone()
+	c.mu.Unlock()
+
+	return cfg, nil
+}
+
+func (c *Cache) SetDeduction(ctx context.Context, t string, n float64, a Actor) (Config, error) {
+	defer c.Invalidate()
+	return c.Database.SetDeduction(ctx, t, n, a)
+}
+
+func (c *Cache) SetLimits(ctx context.Context, l Limits, a Actor) (Config, error) {
+	defer c.Invalidate()
+	return c.Database.SetLimits(ctx, l, a)
+}
+
+func (c *Cache) ReplaceConfig(ctx context.Context, next Config, a Actor) (Config, error) {
+	defer c.Invalidate()
+	return c.Database.ReplaceConfig(ctx, next, a)
+}
+
+func (c *Cache) PatchConfig(ctx context.Context, patch json.RawMessage, a Actor) (Config, error) {
+	defer c.Invalidate()
+	return c.Database.PatchConfig(ctx, patch, a)
+}
+
+func (c *Cache) ScheduleChange(ctx context.Context, sc ScheduledChange, a Actor) (ScheduledChange, error) {
+	defer c.Invalidate()
+	return c.Database.ScheduleChange(ctx, sc, a)
+}
+
+func (c *Cache) CancelScheduledChange(ctx context.Context, id int64, a Actor) (ScheduledChange, error) {
+	defer c.Invalidate()
+	return c.Database.CancelScheduledChange(ctx, id, a)
+}
+
+func (c *Cache) ApplyScheduledChanges(ctx context.Context) (Config, error) {
+	defer c.Invalidate()
+	return c.Database.ApplyScheduledChanges(ctx)
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingDB struct {
+	config.Database
+	reads    int
+	versions int
+}
+
+func (db *countingDB) GetConfig(ctx context.Context) (config.Config, error) {
+	db.reads++
+	return db.Database.GetConfig(ctx)
+}
+
+func (db *countingDB) GetConfigVersion(ctx context.Context, v int64) (config.Config, error) {
+	db.versions++
+	return db.Database.GetConfigVersion(ctx, v)
+}
+
+func TestCache(t *testing.T) {
+	admin := config.Actor{Username: "adminTax"}
+
+	t.Run("Config should be read once within TTL", func(t *testing.T) {
+		db := &countingDB{Database: config.NewMemory()}
+		cache := config.NewCache(db, time.Hour)
+
+		cache.GetConfig(context.Background())
+		c, err := cache.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, c.PersonalDeduction)
+		assert.Equal(t, 1, db.reads)
+	})
+
+	t.Run("Config should be read again after TTL", func(t *testing.T) {
+		db := &countingDB{Database: config.NewMemory()}
+		cache := config.NewCache(db, time.Millisecond)
+
+		cache.GetConfig(context.Background())
+		time.Sleep(2 * time.Millisecond)
+		cache.GetConfig(context.Background())
+
+		assert.Equal(t, 2, db.reads)
+	})
+
+	t.Run("Write should invalidate", func(t *testing.T) {
+		db := &countingDB{Database: config.NewMemory()}
+		cache := config.NewCache(db, time.Hour)
+
+		cache.GetConfig(context.Background())
+		_, err := cache.SetDeduction(context.Background(), config.DeductionType.Personal, 70000, admin)
+		assert.NoError(t, err)
+		c, _ := cache.GetConfig(context.Background())
+
+		assert.Equal(t, 70000.0, c.PersonalDeduction)
+		assert.Equal(t, 2, db.reads)
+	})
+
+	t.Run("Invalidate should drop the config", func(t *testing.T) {
+		mem := config.NewMemory()
+		db := &countingDB{Database: mem}
+		cache := config.NewCache(db, time.Hour)
+
+		cache.GetConfig(context.Background())
+		// changed by another instance
+		mem.SetDeduction(context.Background(), config.DeductionType.KReceipt, 70000, admin)
+		cache.Invalidate()
+		c, _ := cache.GetConfig(context.Background())
+
+		assert.Equal(t, 70000.0, c.MaxKReceipt)
+	})
+
+	t.Run("Config should not be kept past a scheduled change", func(t *testing.T) {
+		cache := config.NewCache(config.NewMemory(), time.Hour)
+		_, err := cache.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: time.Now().Add(20 * time.Millisecond)}, admin)
+		assert.NoError(t, err)
+
+		before, _ := cache.GetConfig(context.Background())
+		time.Sleep(30 * time.Millisecond)
+		after, _ := cache.GetConfig(context.Background())
+
+		assert.Equal(t, config.DEFAULT_MAX_K_RECEIPT, before.MaxKReceipt)
+		assert.Equal(t, 70000.0, after.MaxKReceipt)
+	})
+
+	t.Run("Cached config should not be changed by callers", func(t *testing.T) {
+		cache := config.NewCache(config.NewMemory(), time.Hour)
+
+		c, _ := cache.GetConfig(context.Background())
+		c.TaxBrackets[0].Rate = 1
+		c, _ = cache.GetConfig(context.Background())
+
+		assert.Equal(t, 0.0, c.TaxBrackets[0].Rate)
+	})
+
+	t.Run("Versions should be cached", func(t *testing.T) {
+		db := &countingDB{Database: config.NewMemory()}
+		cache := config.NewCache(db, time.Hour)
+
+		cache.GetConfigVersion(context.Background(), 1)
+		c, err := cache.GetConfigVersion(context.Background(), 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), c.Version)
+		assert.Equal(t, 1, db.versions)
+	})
+}
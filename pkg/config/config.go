@@ -1,32 +1,166 @@
 package config
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 type Config struct {
-	PersonalDeduction float64 `postgres:"personal_deduction" json:"personalDeduction,omitempty"`
-	MaxKReceipt       float64 `postgres:"max_k_receipt" json:"kReceipt,omitempty"`
+	PersonalDeduction float64      `postgres:"deductions" json:"personalDeduction,omitempty"`
+	MaxKReceipt       float64      `postgres:"deductions" json:"kReceipt,omitempty"`
+	TaxBrackets       []TaxBracket `postgres:"tax_brackets" json:"taxBrackets,omitempty"`
+	DeductionLimits   *Limits      `postgres:"limits" json:"limits,omitempty"`
+	Version           int64        `postgres:"version" json:"version,omitempty"`
+}
+
+// TaxBracket taxes the part of the taxable income above Min and up to Max.
+// Max 0 means the bracket has no upper bound.
+type TaxBracket struct {
+	Level string  `json:"level"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max,omitempty"`
+	Rate  float64 `json:"rate"`
+}
+
+// Limits are the ranges admins are allowed to set deductions in, and the
+// maximum donation users can deduct.
+type Limits struct {
+	MaxDonation       float64 `json:"maxDonation"`
+	PersonalDeduction Range   `json:"personalDeduction"`
+	KReceipt          Range   `json:"kReceipt"`
+}
+
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type ConfigVersion struct {
+	Version     int64     `json:"version"`
+	EffectiveAt time.Time `json:"effectiveAt"`
+	Config      Config    `json:"config"`
 }
 
 type Database interface {
-	GetConfig() (Config, error)
-	SetPersonalDeduction(float64) (Config, error)
-	SetMaxKReceipt(float64) (Config, error)
+	GetConfig(context.Context) (Config, error)
+	GetConfigVersion(context.Context, int64) (Config, error)
+	ListConfigVersions(context.Context) ([]ConfigVersion, error)
+	SetDeduction(context.Context, string, float64, Actor) (Config, error)
+	SetLimits(context.Context, Limits, Actor) (Config, error)
+	ReplaceConfig(context.Context, Config, Actor) (Config, error)
+	PatchConfig(context.Context, json.RawMessage, Actor) (Config, error)
+	ListAudit(context.Context, AuditFilter) (AuditPage, error)
+	GetConfigAt(context.Context, time.Time) (Config, error)
+	ScheduleChange(context.Context, ScheduledChange, Actor) (ScheduledChange, error)
+	ListScheduledChanges(ctx context.Context, status string) ([]ScheduledChange, error)
+	CancelScheduledChange(context.Context, int64, Actor) (ScheduledChange, error)
+	ApplyScheduledChanges(context.Context) (Config, error)
+}
+
+var ErrConfigVersionNotFound = errors.New("config version not found")
+
+// ConfigError is a config that breaks a rule, with a message that can be
+// translated: Format is its key in the locale catalogs.
+type ConfigError struct {
+	Format string
+	Args   []interface{}
+}
+
+func configErrorf(format string, args ...interface{}) error {
+	return ConfigError{Format: format, Args: args}
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf(e.Format, e.Args...)
+}
+
+// InvalidConfigError is returned when a change would leave the config outside
+// the limits admins are allowed to set.
+type InvalidConfigError struct {
+	Err error
+}
+
+func (e InvalidConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e InvalidConfigError) Unwrap() error {
+	return e.Err
 }
 
 const (
 	DEFAULT_PERSONAL_DEDUCTION = 60000.0
 	DEFAULT_MAX_K_RECEIPT      = 50000.0
-	MAX_K_RECEIPT              = 100000.0
-	MIN_K_RECEIPT              = 0.0
-	MAX_DONATION               = 100000.0
-	MAX_PERSONAL_DEDUCTION     = 100000.0
-	MIN_PERSONAL_DEDUCTION     = 10000.0
 )
 
+// Default limits, used until an admin sets their own.
+const (
+	MAX_K_RECEIPT          = 100000.0
+	MIN_K_RECEIPT          = 0.0
+	MAX_DONATION           = 100000.0
+	MAX_PERSONAL_DEDUCTION = 100000.0
+	MIN_PERSONAL_DEDUCTION = 10000.0
+)
+
+func DefaultTaxBrackets() []TaxBracket {
+	return []TaxBracket{
+		{Level: "0-150,000", Min: 0, Max: 150000, Rate: 0},
+		{Level: "150,001-500,000", Min: 150000, Max: 500000, Rate: 0.10},
+		{Level: "500,001-1,000,000", Min: 500000, Max: 1000000, Rate: 0.15},
+		{Level: "1,000,001-2,000,000", Min: 1000000, Max: 2000000, Rate: 0.20},
+		{Level: "2,000,001 ขึ้นไป", Min: 2000000, Rate: 0.35},
+	}
+}
+
+// DefaultConfig is the config in use until an admin saves one.
+func DefaultConfig() Config {
+	return Config{
+		PersonalDeduction: DEFAULT_PERSONAL_DEDUCTION,
+		MaxKReceipt:       DEFAULT_MAX_K_RECEIPT,
+	}.withDefaults()
+}
+
+// Brackets returns the tax brackets of the config, falling back to the
+// default brackets for configs built without them.
+func (c Config) Brackets() []TaxBracket {
+	if len(c.TaxBrackets) == 0 {
+		return DefaultTaxBrackets()
+	}
+	return c.TaxBrackets
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDonation:       MAX_DONATION,
+		PersonalDeduction: Range{Min: MIN_PERSONAL_DEDUCTION, Max: MAX_PERSONAL_DEDUCTION},
+		KReceipt:          Range{Min: MIN_K_RECEIPT, Max: MAX_K_RECEIPT},
+	}
+}
+
+// Limits returns the limits of the config, falling back to the default
+// limits for configs saved before limits were configurable.
+func (c Config) Limits() Limits {
+	if c.DeductionLimits == nil {
+		return DefaultLimits()
+	}
+	return *c.DeductionLimits
+}
+
+// withDefaults fills in the parts of the config that fall back to defaults,
+// so responses and snapshots always show the values in use.
+func (c Config) withDefaults() Config {
+	c.TaxBrackets = c.Brackets()
+	l := c.Limits()
+	c.DeductionLimits = &l
+	return c
+}
+
 var AllowanceType = struct {
 	Donation string
 	KReceipt string
@@ -35,48 +169,394 @@ var AllowanceType = struct {
 	KReceipt: "k-receipt",
 }
 
-func (p *Postgres) GetConfig() (c Config, err error) {
-	c = Config{
-		PersonalDeduction: DEFAULT_PERSONAL_DEDUCTION,
-		MaxKReceipt:       DEFAULT_MAX_K_RECEIPT,
+const configColumns = "deductions, tax_brackets, limits, version"
+
+const dueColumn = "EXISTS (SELECT 1 FROM config_schedule WHERE status = 'pending' AND effective_from <= now())"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanConfig(row scanner, c *Config, extra ...interface{}) error {
+	var deductions, brackets, limits []byte
+	dest := append([]interface{}{&deductions, &brackets, &limits, &c.Version}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
 	}
-	err = p.Db.QueryRow("SELECT * FROM config").Scan(&c.PersonalDeduction, &c.MaxKReceipt)
 
+	if len(brackets) > 0 {
+		if err := json.Unmarshal(brackets, &c.TaxBrackets); err != nil {
+			return err
+		}
+	}
+	if len(limits) > 0 {
+		if err := json.Unmarshal(limits, &c.DeductionLimits); err != nil {
+			return err
+		}
+	}
+	if len(deductions) > 0 {
+		amounts := map[string]float64{}
+		if err := json.Unmarshal(deductions, &amounts); err != nil {
+			return err
+		}
+		c.setDeductionAmounts(amounts)
+	}
+	*c = c.withDefaults()
+
+	return nil
+}
+
+// GetConfig returns the current config, or the defaults when no config has
+// been saved yet. It never writes: scheduled changes that took effect since
+// ApplyScheduledChanges last ran are applied to the result without a version.
+func (p *Postgres) GetConfig(ctx context.Context) (c Config, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	var due bool
+	err = scanConfig(p.Db.QueryRowContext(ctx, "SELECT "+configColumns+", "+dueColumn+" FROM config WHERE id"), &c, &due)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultConfig(), nil
+	}
 	if err != nil {
 		return Config{}, err
 	}
 
-	return c, nil
+	if due {
+		c, err = projectConfig(ctx, c, p.ListScheduledChanges, time.Now())
+		c.Version = 0
+	}
+
+	return c, err
+}
+
+func (p *Postgres) GetConfigVersion(ctx context.Context, version int64) (_ Config, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	v, err := scanConfigVersion(p.Db.QueryRowContext(ctx, "SELECT id, config, effective_at FROM config_versions WHERE id = $1", version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Config{}, ErrConfigVersionNotFound
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	return v.Config, nil
+}
+
+func (p *Postgres) ListConfigVersions(ctx context.Context) (_ []ConfigVersion, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	rows, err := p.Db.QueryContext(ctx, "SELECT id, config, effective_at FROM config_versions ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []ConfigVersion{}
+	for rows.Next() {
+		v, err := scanConfigVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func scanConfigVersion(row scanner) (v ConfigVersion, err error) {
+	var snapshot []byte
+	if err = row.Scan(&v.Version, &snapshot, &v.EffectiveAt); err != nil {
+		return ConfigVersion{}, err
+	}
+
+	if err = json.Unmarshal(snapshot, &v.Config); err != nil {
+		return ConfigVersion{}, err
+	}
+	v.Config.Version = v.Version
+	v.Config = v.Config.withDefaults()
+
+	return v, nil
+}
+
+// SetDeduction sets the amount of the deduction type, which must be within
+// the range of its rule.
+func (p *Postgres) SetDeduction(ctx context.Context, t string, n float64, a Actor) (Config, error) {
+	if _, err := GetDeductionRule(t); err != nil {
+		return Config{}, err
+	}
+
+	return p.update(ctx, a, func(c *Config) error {
+		if err := c.SetDeduction(t, n); err != nil {
+			return err
+		}
+		return c.validate()
+	})
+}
 
+// SetLimits replaces the limits. It fails when the current deductions are not
+// within the new limits, so they have to be changed first.
+func (p *Postgres) SetLimits(ctx context.Context, l Limits, a Actor) (Config, error) {
+	return p.update(ctx, a, func(c *Config) error {
+		c.DeductionLimits = &l
+		return c.validate()
+	})
 }
 
-func (p *Postgres) SetPersonalDeduction(n float64) (config Config, err error) {
-	err = p.Db.QueryRow("UPDATE config SET personal_deduction = $1 RETURNING personal_deduction", n).Scan(&config.PersonalDeduction)
+// ReplaceConfig validates the whole config and makes it the current config.
+func (p *Postgres) ReplaceConfig(ctx context.Context, next Config, a Actor) (Config, error) {
+	return p.update(ctx, a, func(c *Config) error {
+		*c = next.withDefaults().clone()
+		return c.validate()
+	})
+}
+
+// PatchConfig applies a JSON Merge Patch to the current config. The patch is
+// applied to the config read inside the transaction, so concurrent changes to
+// other fields are kept.
+func (p *Postgres) PatchConfig(ctx context.Context, patch json.RawMessage, a Actor) (Config, error) {
+	return p.update(ctx, a, func(c *Config) error {
+		next, err := c.Apply(patch)
+		if err != nil {
+			return InvalidConfigError{err}
+		}
+		*c = next
+		return c.validate()
+	})
+}
+
+// update applies the change to the current config and records the result as
+// a new immutable version, so earlier calculations can be reproduced. Every
+// changed field is written to the audit log in the same transaction.
+// Scheduled changes that are already due are applied first; a nil apply
+// only applies those, or saves the defaults when there is no config yet. A
+// change that would strand a pending change fails.
+func (p *Postgres) update(ctx context.Context, a Actor, apply func(*Config) error) (_ Config, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	tx, err := p.Db.BeginTx(ctx, nil)
 	if err != nil {
 		return Config{}, err
 	}
-	return config, nil
+	defer tx.Rollback()
+
+	var c Config
+	err = scanConfig(tx.QueryRowContext(ctx, "SELECT "+configColumns+" FROM config WHERE id FOR UPDATE"), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		c = DefaultConfig()
+	} else if err != nil {
+		return Config{}, err
+	}
+
+	c, err = applyDueChanges(ctx, tx, c)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if apply != nil {
+		next := c.clone()
+		if err := apply(&next); err != nil {
+			return Config{}, err
+		}
+
+		pending, err := queryScheduledChanges(ctx, tx,
+			"SELECT "+scheduleColumns+" FROM config_schedule WHERE status = $1 ORDER BY effective_from, id", ScheduleStatus.Pending,
+		)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := checkPending(next, pending); err != nil {
+			return Config{}, err
+		}
+
+		c, err = saveVersion(ctx, tx, c, next, a, nil)
+		if err != nil {
+			return Config{}, err
+		}
+	} else if c.Version == 0 {
+		// No config was saved yet: the defaults become the first version, so
+		// calculations made with them have a version too.
+		c, err = saveVersion(ctx, tx, c, c, a, nil)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
 }
 
-func (p *Postgres) SetMaxKReceipt(n float64) (config Config, err error) {
-	err = p.Db.QueryRow("UPDATE config SET max_k_receipt = $1 RETURNING max_k_receipt", n).Scan(&config.MaxKReceipt)
+// saveVersion stores next as a new version effective at effectiveAt (now when
+// nil), makes it the current config and audits the fields changed from old.
+// The config table holds a single row, created by the first save.
+func saveVersion(ctx context.Context, tx *sql.Tx, old Config, next Config, a Actor, effectiveAt *time.Time) (Config, error) {
+	next.Version = 0
+
+	entries, err := diffConfig(old, next, a)
+	if err != nil {
+		return Config{}, err
+	}
+
+	snapshot, err := json.Marshal(next)
+	if err != nil {
+		return Config{}, err
+	}
+	deductions, err := json.Marshal(next.deductionAmounts())
+	if err != nil {
+		return Config{}, err
+	}
+	brackets, err := json.Marshal(next.TaxBrackets)
+	if err != nil {
+		return Config{}, err
+	}
+	limits, err := json.Marshal(next.DeductionLimits)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO config_versions (config, effective_at) VALUES ($1, COALESCE($2, now())) RETURNING id",
+		snapshot, effectiveAt,
+	).Scan(&next.Version)
+	if err != nil {
+		return Config{}, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO config (id, deductions, tax_brackets, limits, version) VALUES (TRUE, $1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET deductions = EXCLUDED.deductions, tax_brackets = EXCLUDED.tax_brackets, limits = EXCLUDED.limits, version = EXCLUDED.version`,
+		deductions, brackets, limits, next.Version,
+	)
 	if err != nil {
 		return Config{}, err
 	}
-	return config, nil
+
+	if err := insertAudit(ctx, tx, entries, next.Version); err != nil {
+		return Config{}, err
+	}
+
+	return next, nil
+}
+
+func (c Config) clone() Config {
+	c.TaxBrackets = append([]TaxBracket{}, c.TaxBrackets...)
+	if c.DeductionLimits != nil {
+		l := *c.DeductionLimits
+		c.DeductionLimits = &l
+	}
+	return c
+}
+
+// Validate checks the config against the limits admins are allowed to set.
+func (c Config) Validate() error {
+	if err := c.Limits().Validate(); err != nil {
+		return err
+	}
+	for _, r := range deductionRules {
+		if err := r.validate(c); err != nil {
+			return err
+		}
+	}
+	return validateTaxBrackets(c.TaxBrackets)
+}
+
+// validate is Validate for use inside update, where an invalid config is the
+// caller's fault rather than a database error.
+func (c Config) validate() error {
+	if err := c.Validate(); err != nil {
+		return InvalidConfigError{err}
+	}
+	return nil
+}
+
+func (l Limits) Validate() error {
+	if err := l.PersonalDeduction.validate("Personal deduction"); err != nil {
+		return err
+	}
+	return l.KReceipt.validate("K-Receipt")
+}
+
+func (r Range) validate(name string) error {
+	if r.Min < 0 {
+		return configErrorf("%s minimum must not be negative", name)
+	}
+	if r.Max < r.Min {
+		return configErrorf("%s maximum must not be less than its minimum", name)
+	}
+	return nil
+}
+
+// validateTaxBrackets checks that the brackets start at 0, follow each other
+// without gaps and end with an unbounded bracket.
+func validateTaxBrackets(brackets []TaxBracket) error {
+	if len(brackets) == 0 {
+		return nil
+	}
+
+	prev := 0.0
+	for i, b := range brackets {
+		if b.Min != prev {
+			return configErrorf("Tax bracket %q must start at %0.f", b.Level, prev)
+		}
+		if b.Rate < 0 || b.Rate > 1 {
+			return configErrorf("Tax bracket %q rate must be between 0 and 1", b.Level)
+		}
+		last := i == len(brackets)-1
+		if last && b.Max != 0 {
+			return configErrorf("Last tax bracket %q must not have a maximum", b.Level)
+		}
+		if !last && b.Max <= b.Min {
+			return configErrorf("Tax bracket %q maximum must be more than %0.f", b.Level, b.Min)
+		}
+		prev = b.Max
+	}
+	return nil
 }
 
 type Deduction struct {
-	Amount *float64 `json:"amount" validate:"required,gte=0"`
+	Amount        *float64   `json:"amount" validate:"required,gte=0"`
+	EffectiveFrom *time.Time `json:"effectiveFrom,omitempty"`
+}
+
+// ConfigBody is the full config document accepted by PUT /admin/config.
+type ConfigBody struct {
+	PersonalDeduction *float64     `json:"personalDeduction" validate:"required"`
+	MaxKReceipt       *float64     `json:"kReceipt" validate:"required"`
+	TaxBrackets       []TaxBracket `json:"taxBrackets" validate:"required,min=1"`
+	Limits            *Limits      `json:"limits" validate:"required"`
+}
+
+func (b ConfigBody) Config() Config {
+	return Config{
+		PersonalDeduction: *b.PersonalDeduction,
+		MaxKReceipt:       *b.MaxKReceipt,
+		TaxBrackets:       b.TaxBrackets,
+		DeductionLimits:   b.Limits,
+	}
+}
+
+type ScheduleChangeBody struct {
+	Changes       json.RawMessage `json:"changes" validate:"required"`
+	EffectiveFrom *time.Time      `json:"effectiveFrom" validate:"required"`
 }
 
 func (d *Deduction) BindAndValidateStruct(c echo.Context) error {
 	if err := c.Bind(d); err != nil {
-		return fmt.Errorf("err: Cannot bind JSON")
+		return fmt.Errorf("err: Cannot bind JSON: %w", err)
 	}
 
 	if err := c.Validate(d); err != nil {
-		return fmt.Errorf("err: Invailid json body")
+		return fmt.Errorf("err: Invailid json body: %w", err)
 	}
 
 	return nil
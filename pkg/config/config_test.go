@@ -1,11 +1,15 @@
 package config_test
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jaiieth/assessment-tax/helper"
@@ -23,7 +27,7 @@ func TestGetConfig(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT *").WillReturnRows(sqlmock.NewRows([]string{"personal_deduction", "max_k_receipt"}).AddRow(5000, 10000))
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(5000, 10000), nil, nil, 3, false))
 
 		p := &config.Postgres{
 			Db: db,
@@ -32,11 +36,32 @@ func TestGetConfig(t *testing.T) {
 		expPersonalDeduction := 5000.0
 		expMaxKReceipt := 10000.0
 
-		config, err := p.GetConfig()
+		cfg, err := p.GetConfig(context.Background())
 
 		assert.NoError(t, err)
-		assert.Equal(t, expPersonalDeduction, config.PersonalDeduction)
-		assert.Equal(t, expMaxKReceipt, config.MaxKReceipt)
+		assert.Equal(t, expPersonalDeduction, cfg.PersonalDeduction)
+		assert.Equal(t, expMaxKReceipt, cfg.MaxKReceipt)
+		assert.Equal(t, int64(3), cfg.Version)
+		assert.Equal(t, config.DefaultTaxBrackets(), cfg.TaxBrackets)
+	})
+
+	t.Run("Stored tax brackets", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(5000, 10000), []byte(`[{"level":"all","min":0,"rate":0.1}]`), nil, 1, false))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, []config.TaxBracket{{Level: "all", Rate: 0.1}}, cfg.TaxBrackets)
 	})
 
 	t.Run("Failed", func(t *testing.T) {
@@ -46,13 +71,149 @@ func TestGetConfig(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("SELECT *").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id").WillReturnError(sql.ErrConnDone)
 
 		p := &config.Postgres{
 			Db: db,
 		}
 
-		_, err = p.GetConfig()
+		_, err = p.GetConfig(context.Background())
+
+		assert.Error(t, err)
+	})
+
+	t.Run("No saved config should return defaults", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id").WillReturnError(sql.ErrNoRows)
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DefaultConfig(), cfg)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, cfg.PersonalDeduction)
+		assert.Equal(t, config.DefaultTaxBrackets(), cfg.TaxBrackets)
+		assert.Equal(t, int64(0), cfg.Version)
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id").
+		WillDelayFor(time.Second).
+		WillReturnRows(currentConfigRows().AddRow(deductions(60000, 50000), nil, nil, 1, false))
+
+	p := &config.Postgres{
+		Db:      db,
+		Timeout: 10 * time.Millisecond,
+	}
+
+	_, err = p.GetConfig(context.Background())
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGetConfigVersion(t *testing.T) {
+	effectiveAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Success", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config_versions WHERE id").WithArgs(int64(2)).
+			WillReturnRows(versionRows().AddRow(2, []byte(`{"personalDeduction":70000,"kReceipt":50000}`), effectiveAt))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.GetConfigVersion(context.Background(), 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, cfg.PersonalDeduction)
+		assert.Equal(t, 50000.0, cfg.MaxKReceipt)
+		assert.Equal(t, int64(2), cfg.Version)
+		assert.Equal(t, config.DefaultTaxBrackets(), cfg.TaxBrackets)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config_versions WHERE id").WillReturnError(sql.ErrNoRows)
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.GetConfigVersion(context.Background(), 99)
+
+		assert.ErrorIs(t, err, config.ErrConfigVersionNotFound)
+	})
+}
+
+func TestListConfigVersions(t *testing.T) {
+	effectiveAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Success", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config_versions ORDER BY id DESC").
+			WillReturnRows(versionRows().
+				AddRow(2, []byte(`{"personalDeduction":70000}`), effectiveAt.Add(time.Hour)).
+				AddRow(1, []byte(`{"personalDeduction":60000}`), effectiveAt))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		versions, err := p.ListConfigVersions(context.Background())
+
+		assert.NoError(t, err)
+		assert.Len(t, versions, 2)
+		assert.Equal(t, int64(2), versions[0].Version)
+		assert.Equal(t, int64(2), versions[0].Config.Version)
+		assert.Equal(t, effectiveAt, versions[1].EffectiveAt)
+		assert.Equal(t, 60000.0, versions[1].Config.PersonalDeduction)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config_versions").WillReturnError(sql.ErrConnDone)
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.ListConfigVersions(context.Background())
 
 		assert.Error(t, err)
 	})
@@ -67,8 +228,7 @@ func TestSetMaxKRecepit(t *testing.T) {
 		defer db.Close()
 
 		queryArgs := 10000.0
-		mock.ExpectQuery("UPDATE config").
-			WithArgs(queryArgs).WillReturnRows(sqlmock.NewRows([]string{"max_k_receipt"}).AddRow(queryArgs))
+		expectUpdate(mock, 60000.0, queryArgs, 5, "kReceipt", "50000", "10000")
 
 		p := &config.Postgres{
 			Db: db,
@@ -76,10 +236,12 @@ func TestSetMaxKRecepit(t *testing.T) {
 
 		expectedResult := 10000.0
 
-		config, err := p.SetMaxKReceipt(queryArgs)
+		config, err := p.SetDeduction(context.Background(), config.DeductionType.KReceipt, queryArgs, config.Actor{Username: "adminTax", RequestID: "req-1"})
 
 		assert.NoError(t, err)
 		assert.Equal(t, expectedResult, config.MaxKReceipt)
+		assert.Equal(t, int64(5), config.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("Failed", func(t *testing.T) {
@@ -89,15 +251,41 @@ func TestSetMaxKRecepit(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("UPDATE config").WillReturnError(sql.ErrNoRows)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.SetDeduction(context.Background(), config.DeductionType.KReceipt, 10000.0, config.Actor{})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Failed to insert version should rollback", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+		mock.ExpectQuery("INSERT INTO config_versions").WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
 		p := &config.Postgres{
 			Db: db,
 		}
 
-		_, err = p.SetMaxKReceipt(10000.0)
+		_, err = p.SetDeduction(context.Background(), config.DeductionType.KReceipt, 10000.0, config.Actor{})
 
 		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
@@ -110,8 +298,7 @@ func TestSetPersonalDeduction(t *testing.T) {
 		defer db.Close()
 
 		queryArgs := 10000.0
-		mock.ExpectQuery("UPDATE config").
-			WithArgs(queryArgs).WillReturnRows(sqlmock.NewRows([]string{"personal_deduction"}).AddRow(queryArgs))
+		expectUpdate(mock, queryArgs, 50000.0, 5, "personalDeduction", "60000", "10000")
 
 		p := &config.Postgres{
 			Db: db,
@@ -119,10 +306,12 @@ func TestSetPersonalDeduction(t *testing.T) {
 
 		expectedResult := 10000.0
 
-		config, err := p.SetPersonalDeduction(queryArgs)
+		config, err := p.SetDeduction(context.Background(), config.DeductionType.Personal, queryArgs, config.Actor{Username: "adminTax", RequestID: "req-1"})
 
 		assert.NoError(t, err)
 		assert.Equal(t, expectedResult, config.PersonalDeduction)
+		assert.Equal(t, int64(5), config.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("Failed", func(t *testing.T) {
@@ -132,18 +321,428 @@ func TestSetPersonalDeduction(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectQuery("UPDATE config").WillReturnError(sql.ErrNoRows)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
 		p := &config.Postgres{
 			Db: db,
 		}
 
-		_, err = p.SetPersonalDeduction(10000.0)
+		_, err = p.SetDeduction(context.Background(), config.DeductionType.Personal, 10000.0, config.Actor{})
 
 		assert.Error(t, err)
 	})
 }
 
+func TestFirstSaveShouldCreateConfigRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("INSERT INTO config_versions").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO config \(id(.+)ON CONFLICT \(id\) DO UPDATE`).
+		WithArgs(deductions(70000, config.DEFAULT_MAX_K_RECEIPT), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO config_audit").
+		WithArgs("adminTax", "personalDeduction", []byte("60000"), []byte("70000"), 1, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	c, err := p.SetDeduction(context.Background(), config.DeductionType.Personal, 70000, config.Actor{Username: "adminTax"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 70000.0, c.PersonalDeduction)
+	assert.Equal(t, int64(1), c.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyWithoutConfigShouldSaveDefaults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("INSERT INTO config_versions").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO config \(id(.+)ON CONFLICT \(id\) DO UPDATE`).
+		WithArgs(deductions(config.DEFAULT_PERSONAL_DEDUCTION, config.DEFAULT_MAX_K_RECEIPT), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	c, err := p.ApplyScheduledChanges(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, c.PersonalDeduction)
+	assert.Equal(t, int64(1), c.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetUnchangedValueShouldNotAudit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("INSERT INTO config_versions").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(`INSERT INTO config \(id`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	_, err = p.SetDeduction(context.Background(), config.DeductionType.Personal, 60000, config.Actor{Username: "adminTax"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetMaxDonation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("INSERT INTO config_versions").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(`INSERT INTO config \(id`).
+		WithArgs([]byte(`{"donation":50000,"k-receipt":50000,"personal":60000}`), sqlmock.AnyArg(), []byte(`{"maxDonation":50000,"personalDeduction":{"min":10000,"max":100000},"kReceipt":{"min":0,"max":100000}}`), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO config_audit").
+		WithArgs("adminTax", "limits", sqlmock.AnyArg(), sqlmock.AnyArg(), 2, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	c, err := p.SetDeduction(context.Background(), config.DeductionType.Donation, 50000, config.Actor{Username: "adminTax"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 50000.0, c.Limits().MaxDonation)
+	assert.Equal(t, int64(2), c.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetLimits(t *testing.T) {
+	t.Run("Current deduction outside new limits should roll back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+		mock.ExpectRollback()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		l := config.DefaultLimits()
+		l.PersonalDeduction.Max = 50000
+		_, err = p.SetLimits(context.Background(), l, config.Actor{})
+
+		var invalid config.InvalidConfigError
+		assert.ErrorAs(t, err, &invalid)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Stored limits and deductions should be read back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		stored := []byte(`{"personal":150000,"k-receipt":50000,"donation":20000}`)
+		limits := []byte(`{"maxDonation":100000,"personalDeduction":{"min":10000,"max":200000},"kReceipt":{"min":0,"max":100000}}`)
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(stored, nil, limits, 3, false))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		c, err := p.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 20000.0, c.Limits().MaxDonation)
+		assert.Equal(t, config.Range{Min: 10000, Max: 200000}, c.Limits().PersonalDeduction)
+		assert.NoError(t, c.Validate())
+	})
+}
+
+func TestReplaceConfig(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+		mock.ExpectQuery("INSERT INTO config_versions").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectExec(`INSERT INTO config \(id`).
+			WithArgs(deductions(70000, 80000), sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO config_audit").
+			WithArgs("adminTax", "kReceipt", []byte("50000"), []byte("80000"), 2, "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO config_audit").
+			WithArgs("adminTax", "personalDeduction", []byte("60000"), []byte("70000"), 2, "").
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		c, err := p.ReplaceConfig(context.Background(), config.Config{PersonalDeduction: 70000, MaxKReceipt: 80000}, config.Actor{Username: "adminTax"})
+
+		assert.NoError(t, err)
+		limits := config.DefaultLimits()
+		assert.Equal(t, config.Config{PersonalDeduction: 70000, MaxKReceipt: 80000, TaxBrackets: config.DefaultTaxBrackets(), DeductionLimits: &limits, Version: 2}, c)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid config should roll back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+		mock.ExpectRollback()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.ReplaceConfig(context.Background(), config.Config{PersonalDeduction: 70000, MaxKReceipt: 200000}, config.Actor{})
+
+		var invalid config.InvalidConfigError
+		assert.ErrorAs(t, err, &invalid)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPatchConfig(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectUpdate(mock, 60000.0, 80000.0, 2, "kReceipt", "50000", "80000")
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		c, err := p.PatchConfig(context.Background(), json.RawMessage(`{"kReceipt": 80000}`), config.Actor{Username: "adminTax", RequestID: "req-1"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 60000.0, c.PersonalDeduction)
+		assert.Equal(t, 80000.0, c.MaxKReceipt)
+		assert.Equal(t, int64(2), c.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	invalid := map[string]string{
+		"Out of range":  `{"personalDeduction": 5000}`,
+		"Unknown field": `{"unknown": 1}`,
+	}
+	for name, patch := range invalid {
+		t.Run(name+" should roll back", func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+			mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+			mock.ExpectRollback()
+
+			p := &config.Postgres{
+				Db: db,
+			}
+
+			_, err = p.PatchConfig(context.Background(), json.RawMessage(patch), config.Actor{})
+
+			var invalid config.InvalidConfigError
+			assert.ErrorAs(t, err, &invalid)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListAudit(t *testing.T) {
+	columns := []string{"id", "username", "field", "old_value", "new_value", "version", "request_id", "changed_at"}
+	changedAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Success with filters", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM config_audit WHERE field = $1 AND changed_at >= $2 AND changed_at <= $3")).
+			WithArgs("kReceipt", changedAt, changedAt.Add(time.Hour)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("ORDER BY changed_at DESC, id DESC LIMIT $4 OFFSET $5")).
+			WithArgs("kReceipt", changedAt, changedAt.Add(time.Hour), config.DEFAULT_AUDIT_LIMIT, 0).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "adminTax", "kReceipt", []byte("50000"), []byte("70000"), 2, "req-1", changedAt))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		page, err := p.ListAudit(context.Background(), config.AuditFilter{Field: "kReceipt", From: changedAt, To: changedAt.Add(time.Hour)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, page.Total)
+		assert.Equal(t, []config.AuditEntry{{
+			ID:        1,
+			Username:  "adminTax",
+			Field:     "kReceipt",
+			OldValue:  []byte("50000"),
+			NewValue:  []byte("70000"),
+			Version:   2,
+			RequestID: "req-1",
+			ChangedAt: changedAt,
+		}}, page.Entries)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Limit should be capped", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM config_audit")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("FROM config_audit ORDER BY").
+			WithArgs(config.MAX_AUDIT_LIMIT, 0).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		page, err := p.ListAudit(context.Background(), config.AuditFilter{Limit: 10000})
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.MAX_AUDIT_LIMIT, page.Limit)
+		assert.Equal(t, []config.AuditEntry{}, page.Entries)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT COUNT").WillReturnError(sql.ErrConnDone)
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.ListAudit(context.Background(), config.AuditFilter{})
+
+		assert.Error(t, err)
+	})
+}
+
+func currentConfigRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"deductions", "tax_brackets", "limits", "version", "due"})
+}
+
+func scheduleRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "changes", "effective_from", "status", "username", "request_id", "created_at", "applied_version", "cancelled_by", "cancelled_at", "failure"})
+}
+
+// deductions returns the deductions column with the default donation cap.
+func deductions(personal float64, kReceipt float64) []byte {
+	b, _ := json.Marshal(map[string]float64{
+		config.DeductionType.Personal: personal,
+		config.DeductionType.KReceipt: kReceipt,
+		config.DeductionType.Donation: config.MAX_DONATION,
+	})
+	return b
+}
+
+func configRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"deductions", "tax_brackets", "limits", "version"})
+}
+
+func versionRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "config", "effective_at"})
+}
+
+// expectUpdate expects a config update that starts from the default config
+// and ends with the given values stored as the given version, auditing the
+// single changed field.
+func expectUpdate(mock sqlmock.Sqlmock, personalDeduction float64, maxKReceipt float64, version int64, field string, old string, new string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").
+		WillReturnRows(configRows().AddRow(deductions(config.DEFAULT_PERSONAL_DEDUCTION, config.DEFAULT_MAX_K_RECEIPT), nil, nil, version-1))
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").WillReturnRows(scheduleRows())
+	mock.ExpectQuery("INSERT INTO config_versions").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(version))
+	mock.ExpectExec(`INSERT INTO config \(id`).
+		WithArgs(deductions(personalDeduction, maxKReceipt), sqlmock.AnyArg(), sqlmock.AnyArg(), version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO config_audit").
+		WithArgs("adminTax", field, []byte(old), []byte(new), version, "req-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
 func TestBindAndValidateStruct(t *testing.T) {
 	// The function should correctly bind and validate the JSON request body.
 	t.Run("ValidRequestBody", func(t *testing.T) {
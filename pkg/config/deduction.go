@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"math"
+)
+
+var DeductionType = struct {
+	Personal string
+	KReceipt string
+	Donation string
+}{
+	Personal: "personal",
+	KReceipt: AllowanceType.KReceipt,
+	Donation: AllowanceType.Donation,
+}
+
+var ErrUnknownDeduction = errors.New("unknown deduction type")
+
+// DeductionRule describes a deduction admins can set: where it lives in the
+// config document and the range it must be in. Adding a deduction only needs
+// a new rule; the store, handler and route are shared.
+type DeductionRule struct {
+	Type string
+	Name string
+	// Path is the location of the amount in the config JSON document.
+	Path  []string
+	get   func(Config) float64
+	set   func(*Config, float64)
+	limit func(Limits) Range
+}
+
+// DeductionValue is a deduction amount with the range it can be set in. Max is
+// omitted when the deduction has no upper limit.
+type DeductionValue struct {
+	Type   string   `json:"type"`
+	Amount float64  `json:"amount"`
+	Min    float64  `json:"min"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+var deductionRules = []DeductionRule{
+	{
+		Type:  DeductionType.Personal,
+		Name:  "Personal deduction",
+		Path:  []string{"personalDeduction"},
+		get:   func(c Config) float64 { return c.PersonalDeduction },
+		set:   func(c *Config, n float64) { c.PersonalDeduction = n },
+		limit: func(l Limits) Range { return l.PersonalDeduction },
+	},
+	{
+		Type:  DeductionType.KReceipt,
+		Name:  "Maximum K-Receipt",
+		Path:  []string{"kReceipt"},
+		get:   func(c Config) float64 { return c.MaxKReceipt },
+		set:   func(c *Config, n float64) { c.MaxKReceipt = n },
+		limit: func(l Limits) Range { return l.KReceipt },
+	},
+	{
+		Type: DeductionType.Donation,
+		Name: "Maximum donation",
+		Path: []string{"limits", "maxDonation"},
+		get:  func(c Config) float64 { return c.Limits().MaxDonation },
+		set: func(c *Config, n float64) {
+			l := c.Limits()
+			l.MaxDonation = n
+			c.DeductionLimits = &l
+		},
+		limit: func(Limits) Range { return Range{Min: 0, Max: math.Inf(1)} },
+	},
+}
+
+func GetDeductionRule(t string) (DeductionRule, error) {
+	for _, r := range deductionRules {
+		if r.Type == t {
+			return r, nil
+		}
+	}
+	return DeductionRule{}, ErrUnknownDeduction
+}
+
+// Range returns the range the deduction can be set in under the limits.
+func (r DeductionRule) Range(l Limits) Range {
+	return r.limit(l)
+}
+
+// Changes returns a partial config, in the same shape as Config, that sets
+// the deduction to n.
+func (r DeductionRule) Changes(n float64) map[string]interface{} {
+	changes := map[string]interface{}{}
+	m := changes
+	for _, key := range r.Path[:len(r.Path)-1] {
+		next := map[string]interface{}{}
+		m[key] = next
+		m = next
+	}
+	m[r.Path[len(r.Path)-1]] = n
+	return changes
+}
+
+func (r DeductionRule) validate(c Config) error {
+	n, rng := r.get(c), r.limit(c.Limits())
+	if math.IsInf(rng.Max, 1) {
+		if n < rng.Min {
+			return configErrorf("%s must be at least %0.f", r.Name, rng.Min)
+		}
+		return nil
+	}
+	if n < rng.Min || n > rng.Max {
+		return configErrorf("%s must be between %0.f and %0.f", r.Name, rng.Min, rng.Max)
+	}
+	return nil
+}
+
+// Deduction returns the amount of the deduction type.
+func (c Config) Deduction(t string) (float64, error) {
+	r, err := GetDeductionRule(t)
+	if err != nil {
+		return 0, err
+	}
+	return r.get(c), nil
+}
+
+// SetDeduction sets the amount of the deduction type without validating it.
+func (c *Config) SetDeduction(t string, n float64) error {
+	r, err := GetDeductionRule(t)
+	if err != nil {
+		return err
+	}
+	r.set(c, n)
+	return nil
+}
+
+// Deductions lists every deduction type with its amount and range.
+func (c Config) Deductions() []DeductionValue {
+	l := c.Limits()
+	values := []DeductionValue{}
+	for _, r := range deductionRules {
+		rng := r.limit(l)
+		v := DeductionValue{Type: r.Type, Amount: r.get(c), Min: rng.Min}
+		if !math.IsInf(rng.Max, 1) {
+			max := rng.Max
+			v.Max = &max
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// deductionAmounts returns the amount of every deduction type, keyed by type,
+// as stored in the deductions column.
+func (c Config) deductionAmounts() map[string]float64 {
+	amounts := map[string]float64{}
+	for _, r := range deductionRules {
+		amounts[r.Type] = r.get(c)
+	}
+	return amounts
+}
+
+// setDeductionAmounts sets the stored amounts, ignoring types that are no
+// longer known.
+func (c *Config) setDeductionAmounts(amounts map[string]float64) {
+	for t, n := range amounts {
+		if r, err := GetDeductionRule(t); err == nil {
+			r.set(c, n)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeductionRule(t *testing.T) {
+	t.Run("Changes should follow the config document", func(t *testing.T) {
+		cases := map[string]map[string]interface{}{
+			config.DeductionType.Personal: {"personalDeduction": 70000.0},
+			config.DeductionType.KReceipt: {"kReceipt": 70000.0},
+			config.DeductionType.Donation: {"limits": map[string]interface{}{"maxDonation": 70000.0}},
+		}
+		for typ, expected := range cases {
+			r, err := config.GetDeductionRule(typ)
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, r.Changes(70000))
+		}
+	})
+
+	t.Run("Unknown type should return error", func(t *testing.T) {
+		_, err := config.GetDeductionRule("unknown")
+
+		assert.ErrorIs(t, err, config.ErrUnknownDeduction)
+	})
+}
+
+func TestConfigSetDeduction(t *testing.T) {
+	c := config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000}
+
+	assert.NoError(t, c.SetDeduction(config.DeductionType.Donation, 20000))
+	assert.NoError(t, c.SetDeduction(config.DeductionType.KReceipt, 70000))
+	assert.ErrorIs(t, c.SetDeduction("unknown", 1), config.ErrUnknownDeduction)
+
+	donation, err := c.Deduction(config.DeductionType.Donation)
+	assert.NoError(t, err)
+	assert.Equal(t, 20000.0, donation)
+	assert.Equal(t, 20000.0, c.Limits().MaxDonation)
+	assert.Equal(t, 70000.0, c.MaxKReceipt)
+	assert.Equal(t, 60000.0, c.PersonalDeduction)
+}
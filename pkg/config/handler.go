@@ -1,10 +1,16 @@
 package config
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/middleware"
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,53 +22,312 @@ func NewHandler(db Database) Handler {
 	return Handler{DB: db}
 }
 
-func (h Handler) SetPersonalDeductionHandler(c echo.Context) error {
-	var d Deduction
+func (h Handler) SetDeductionHandler(c echo.Context) error {
+	rule, err := GetDeductionRule(c.Param("type"))
+	if err != nil {
+		return helper.NotFound("unknown deduction type", err)
+	}
 
+	var d Deduction
 	if err := d.BindAndValidateStruct(c); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+		return helper.Invalid("invalid request", err)
+	}
+
+	current, err := h.DB.GetConfig(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	r := rule.Range(current.Limits())
+	if err := d.ValidateValue(r.Min, r.Max); err != nil {
+		const message = "%s must be between %0.f and %0.f"
+		violated, limit := "gte", r.Min
+		if *d.Amount > r.Max {
+			violated, limit = "lte", r.Max
+		}
+		return helper.Invalid(i18n.T(i18n.FromContext(c), message, rule.Name, r.Min, r.Max), helper.ValidationError{
+			helper.NewFieldError("/amount", violated, limit, message, rule.Name, r.Min, r.Max),
+		})
+	}
+
+	if d.EffectiveFrom != nil {
+		return h.schedule(c, rule.Changes(*d.Amount), *d.EffectiveFrom)
+	}
+
+	config, err := h.DB.SetDeduction(c.Request().Context(), rule.Type, *d.Amount, actor(c))
+	var invalid InvalidConfigError
+	if errors.As(err, &invalid) {
+		return invalidConfig(c, invalid)
+	}
+	if err != nil {
+		return err
+	}
+
+	amount, _ := config.Deduction(rule.Type)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		rule.Path[len(rule.Path)-1]: amount,
+		"version":                   config.Version,
+	})
+}
+
+func (h Handler) ListDeductionsHandler(c echo.Context) error {
+	config, err := h.DB.GetConfig(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, config.Deductions())
+}
+
+func (h Handler) GetLimitsHandler(c echo.Context) error {
+	config, err := h.DB.GetConfig(c.Request().Context())
+	if err != nil {
+		return err
 	}
+	return c.JSON(http.StatusOK, config.Limits())
+}
 
-	if err := d.ValidateValue(MIN_PERSONAL_DEDUCTION, MAX_PERSONAL_DEDUCTION); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes(fmt.Sprintf(
-			"Personal deduction must be between %0.f and %0.f",
-			MAX_PERSONAL_DEDUCTION, MIN_PERSONAL_DEDUCTION,
-		)))
+func (h Handler) SetLimitsHandler(c echo.Context) error {
+	var l Limits
+	if err := c.Bind(&l); err != nil {
+		return helper.Invalid("invalid request", err)
 	}
+	if err := l.Validate(); err != nil {
+		return invalidConfig(c, err)
+	}
+
+	return h.updateConfig(c, func() (Config, error) {
+		return h.DB.SetLimits(c.Request().Context(), l, actor(c))
+	})
+}
 
-	config, err := h.DB.SetPersonalDeduction(*d.Amount)
+func (h Handler) GetConfigHandler(c echo.Context) error {
+	config, err := h.DB.GetConfig(c.Request().Context())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, config)
+		return err
+
 	}
 	return c.JSON(http.StatusOK, config)
 }
 
-func (h Handler) SetMaxKReceiptHandler(c echo.Context) error {
-	var d Deduction
+func (h Handler) ReplaceConfigHandler(c echo.Context) error {
+	var body ConfigBody
+	if err := c.Bind(&body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+	if err := c.Validate(body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
 
-	if err := d.BindAndValidateStruct(c); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes("invalid request"))
+	next := body.Config().withDefaults()
+	if err := next.Validate(); err != nil {
+		return invalidConfig(c, err)
+	}
+
+	return h.updateConfig(c, func() (Config, error) {
+		return h.DB.ReplaceConfig(c.Request().Context(), next, actor(c))
+	})
+}
+
+func (h Handler) PatchConfigHandler(c echo.Context) error {
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
 	}
 
-	if err := d.ValidateValue(MIN_K_RECEIPT, MAX_K_RECEIPT); err != nil {
-		return c.JSON(http.StatusBadRequest, helper.ErrorRes(fmt.Sprintf(
-			"Maximum K-Receipt must be between  %0.f and %0.f",
-			MAX_K_RECEIPT, MIN_K_RECEIPT,
-		)))
+	// The shape of the patch does not depend on the current config, so it is
+	// checked against an empty one before touching the database.
+	if _, err := (Config{}).Apply(patch); err != nil {
+		return helper.Invalid("invalid request", err)
 	}
 
-	config, err := h.DB.SetMaxKReceipt(*d.Amount)
+	return h.updateConfig(c, func() (Config, error) {
+		return h.DB.PatchConfig(c.Request().Context(), patch, actor(c))
+	})
+}
+
+func (h Handler) updateConfig(c echo.Context, update func() (Config, error)) error {
+	config, err := update()
+	var invalid InvalidConfigError
+	if errors.As(err, &invalid) {
+		return invalidConfig(c, invalid)
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, config)
+		return err
 	}
 	return c.JSON(http.StatusOK, config)
 }
 
-func (h Handler) GetConfigHandler(c echo.Context) error {
-	config, err := h.DB.GetConfig()
+// invalidConfig responds 400 with the message of err in the language of the
+// request.
+func invalidConfig(c echo.Context, err error) error {
+	var rule ConfigError
+	if errors.As(err, &rule) {
+		return helper.Invalid(i18n.T(i18n.FromContext(c), rule.Format, rule.Args...), err)
+	}
+	return helper.Invalid(err.Error(), err)
+}
+
+func (h Handler) ListConfigVersionsHandler(c echo.Context) error {
+	versions, err := h.DB.ListConfigVersions(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (h Handler) GetConfigVersionHandler(c echo.Context) error {
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, helper.ErrorRes("Oops, something went wrong"))
+		return helper.Invalid("invalid request", err)
+	}
 
+	config, err := h.DB.GetConfigVersion(c.Request().Context(), version)
+	if errors.Is(err, ErrConfigVersionNotFound) {
+		return helper.NotFound("config version not found", err)
+	}
+	if err != nil {
+		return err
 	}
 	return c.JSON(http.StatusOK, config)
 }
+
+func (h Handler) ListAuditHandler(c echo.Context) error {
+	f, err := bindAuditFilter(c)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	page, err := h.DB.ListAudit(c.Request().Context(), f)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func (h Handler) ScheduleChangeHandler(c echo.Context) error {
+	var body ScheduleChangeBody
+	if err := c.Bind(&body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+	if err := c.Validate(body); err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	return h.schedule(c, body.Changes, *body.EffectiveFrom)
+}
+
+func (h Handler) ListScheduledChangesHandler(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != "" && status != ScheduleStatus.Pending && status != ScheduleStatus.Applied && status != ScheduleStatus.Cancelled && status != ScheduleStatus.Failed {
+		return helper.Invalid("invalid request", nil)
+	}
+
+	changes, err := h.DB.ListScheduledChanges(c.Request().Context(), status)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, changes)
+}
+
+func (h Handler) CancelScheduledChangeHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	sc, err := h.DB.CancelScheduledChange(c.Request().Context(), id, actor(c))
+	if errors.Is(err, ErrScheduledChangeNotFound) {
+		return helper.NotFound("scheduled change not found", err)
+	}
+	if errors.Is(err, ErrScheduledChangeNotPending) {
+		return helper.Conflict("scheduled change is not pending", err)
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sc)
+}
+
+// schedule validates the changes against the config that will be effective
+// at effectiveFrom, and the pending changes due after it against the result,
+// and stores them as a pending change.
+func (h Handler) schedule(c echo.Context, changes interface{}, effectiveFrom time.Time) error {
+	if !effectiveFrom.After(time.Now()) {
+		return helper.Invalid("effectiveFrom must be in the future", nil)
+	}
+
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+
+	current, err := h.DB.GetConfigAt(c.Request().Context(), effectiveFrom)
+	if err != nil {
+		return err
+	}
+
+	next, err := current.Apply(b)
+	if err != nil {
+		return helper.Invalid("invalid request", err)
+	}
+	if err := next.Validate(); err != nil {
+		return invalidConfig(c, err)
+	}
+
+	pending, err := h.DB.ListScheduledChanges(c.Request().Context(), ScheduleStatus.Pending)
+	if err != nil {
+		return err
+	}
+	later := []ScheduledChange{}
+	for _, sc := range pending {
+		if sc.EffectiveFrom.After(effectiveFrom) {
+			later = append(later, sc)
+		}
+	}
+	if err := checkPending(next, later); err != nil {
+		return invalidConfig(c, err)
+	}
+
+	sc, err := h.DB.ScheduleChange(c.Request().Context(), ScheduledChange{Changes: b, EffectiveFrom: effectiveFrom}, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, sc)
+}
+
+// actor returns the admin authenticated by middleware.Auth and the ID of the
+// current request.
+func actor(c echo.Context) Actor {
+	username, _ := c.Get(middleware.UsernameKey).(string)
+	return Actor{
+		Username:  username,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
+
+func bindAuditFilter(c echo.Context) (f AuditFilter, err error) {
+	f.Field = c.QueryParam("field")
+
+	if v := c.QueryParam("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return AuditFilter{}, err
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return AuditFilter{}, err
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return AuditFilter{}, errors.New("err: invalid limit")
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return AuditFilter{}, errors.New("err: invalid offset")
+		}
+	}
+
+	return f, nil
+}
@@ -2,36 +2,142 @@ package config_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/middleware"
 	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 type mockDB struct {
-	Config config.Config
-	Error  error
+	Config    config.Config
+	Error     error
+	Actor     config.Actor
+	Audit     config.AuditPage
+	Filter    config.AuditFilter
+	Scheduled []config.ScheduledChange
 	mock.Mock
 }
 
-func (m *mockDB) GetConfig() (config.Config, error) {
+func (m *mockDB) GetConfig(ctx context.Context) (config.Config, error) {
 	return m.Config, m.Error
 }
-func (m *mockDB) SetPersonalDeduction(n float64) (config.Config, error) {
-	m.Called(n)
-	return m.Config, m.Error
+func (m *mockDB) GetConfigVersion(ctx context.Context, v int64) (config.Config, error) {
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	if v != m.Config.Version {
+		return config.Config{}, config.ErrConfigVersionNotFound
+	}
+	return m.Config, nil
+}
+func (m *mockDB) ListConfigVersions(ctx context.Context) ([]config.ConfigVersion, error) {
+	return []config.ConfigVersion{{Version: m.Config.Version, Config: m.Config}}, m.Error
 }
-func (m *mockDB) SetMaxKReceipt(n float64) (config.Config, error) {
-	m.Called(n)
+func (m *mockDB) ListAudit(ctx context.Context, f config.AuditFilter) (config.AuditPage, error) {
+	m.Filter = f
+	return m.Audit, m.Error
+}
+func (m *mockDB) GetConfigAt(context.Context, time.Time) (config.Config, error) {
 	return m.Config, m.Error
 }
+func (m *mockDB) ScheduleChange(ctx context.Context, sc config.ScheduledChange, a config.Actor) (config.ScheduledChange, error) {
+	if m.Error != nil {
+		return config.ScheduledChange{}, m.Error
+	}
+	m.Actor = a
+	sc.ID = int64(len(m.Scheduled) + 1)
+	sc.Status = config.ScheduleStatus.Pending
+	sc.Username = a.Username
+	m.Scheduled = append(m.Scheduled, sc)
+	return sc, nil
+}
+func (m *mockDB) ListScheduledChanges(context.Context, string) ([]config.ScheduledChange, error) {
+	return m.Scheduled, m.Error
+}
+func (m *mockDB) ApplyScheduledChanges(ctx context.Context) (config.Config, error) {
+	return m.GetConfig(ctx)
+}
+func (m *mockDB) CancelScheduledChange(ctx context.Context, id int64, a config.Actor) (config.ScheduledChange, error) {
+	if m.Error != nil {
+		return config.ScheduledChange{}, m.Error
+	}
+	for i, sc := range m.Scheduled {
+		if sc.ID == id {
+			m.Scheduled[i].Status = config.ScheduleStatus.Cancelled
+			return m.Scheduled[i], nil
+		}
+	}
+	return config.ScheduledChange{}, config.ErrScheduledChangeNotFound
+}
+func (m *mockDB) SetDeduction(ctx context.Context, t string, n float64, a config.Actor) (config.Config, error) {
+	m.Called(t, n)
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	m.Actor = a
+	if err := m.Config.SetDeduction(t, n); err != nil {
+		return config.Config{}, err
+	}
+	return m.Config, nil
+}
+func (m *mockDB) SetLimits(ctx context.Context, l config.Limits, a config.Actor) (config.Config, error) {
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	next := m.Config
+	next.DeductionLimits = &l
+	if err := next.Validate(); err != nil {
+		return config.Config{}, config.InvalidConfigError{Err: err}
+	}
+	m.Actor = a
+	m.Config = next
+	return m.Config, nil
+}
+func (m *mockDB) ReplaceConfig(ctx context.Context, c config.Config, a config.Actor) (config.Config, error) {
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	m.Actor = a
+	m.Config = c
+	m.Config.Version++
+	return m.Config, nil
+}
+func (m *mockDB) PatchConfig(ctx context.Context, patch json.RawMessage, a config.Actor) (config.Config, error) {
+	if m.Error != nil {
+		return config.Config{}, m.Error
+	}
+	next, err := m.Config.Apply(patch)
+	if err != nil {
+		return config.Config{}, config.InvalidConfigError{Err: err}
+	}
+	if err := next.Validate(); err != nil {
+		return config.Config{}, config.InvalidConfigError{Err: err}
+	}
+	m.Actor = a
+	m.Config = next
+	m.Config.Version++
+	return m.Config, nil
+}
+func setDeduction(h config.Handler, c echo.Context, t string) error {
+	c.SetParamNames("type")
+	c.SetParamValues(t)
+	err := h.SetDeductionHandler(c)
+	helper.ErrorHandler(err, c)
+	return err
+}
+
 func TestSetPersonalDeductionHandler_ValidInput(t *testing.T) {
 	body := config.Deduction{
 		Amount: float64Ptr(50000.0),
@@ -41,7 +147,7 @@ func TestSetPersonalDeductionHandler_ValidInput(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -56,9 +162,9 @@ func TestSetPersonalDeductionHandler_ValidInput(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	db.On("SetPersonalDeduction", 50000.0).Return()
-	h.SetPersonalDeductionHandler(c)
-	db.AssertCalled(t, "SetPersonalDeduction", 50000.0)
+	db.On("SetDeduction", config.DeductionType.Personal, 50000.0).Return()
+	setDeduction(h, c, config.DeductionType.Personal)
+	db.AssertCalled(t, "SetDeduction", config.DeductionType.Personal, 50000.0)
 
 	err = json.Unmarshal(rec.Body.Bytes(), &body)
 	if err != nil {
@@ -76,7 +182,7 @@ func TestSetPersonalDeductionHandler_InvalidInput(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -91,7 +197,7 @@ func TestSetPersonalDeductionHandler_InvalidInput(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	h.SetPersonalDeductionHandler(c)
+	setDeduction(h, c, config.DeductionType.Personal)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
@@ -106,7 +212,7 @@ func TestSetPersonalDeductionHandler_ValueNotInLimit(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -121,9 +227,16 @@ func TestSetPersonalDeductionHandler_ValueNotInLimit(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	h.SetPersonalDeductionHandler(c)
+	setDeduction(h, c, config.DeductionType.Personal)
 
+	var p helper.Problem
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, "Personal deduction must be between 10000 and 100000", p.Detail)
+	assert.Equal(t, helper.ValidationError{{
+		Pointer: "/amount", Rule: "lte", Limit: 100000.0,
+		Message: "Personal deduction must be between 10000 and 100000",
+	}}, p.Errors)
 }
 
 func TestSetPersonalDeductionHandler_GetConfigError(t *testing.T) {
@@ -136,7 +249,7 @@ func TestSetPersonalDeductionHandler_GetConfigError(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -149,10 +262,11 @@ func TestSetPersonalDeductionHandler_GetConfigError(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	db.On("SetPersonalDeduction", 50000.0).Return()
-	h.SetPersonalDeductionHandler(c)
+	db.On("SetDeduction", config.DeductionType.Personal, 50000.0).Return()
+	setDeduction(h, c, config.DeductionType.Personal)
 
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"message": "Oops, something went wrong"}`, rec.Body.String())
 }
 func TestSetMaxKReceiptHandler_ValidInput(t *testing.T) {
 	body := config.Deduction{
@@ -163,7 +277,7 @@ func TestSetMaxKReceiptHandler_ValidInput(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -178,9 +292,9 @@ func TestSetMaxKReceiptHandler_ValidInput(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	db.On("SetMaxKReceipt", 50000.0).Return()
-	h.SetMaxKReceiptHandler(c)
-	db.AssertCalled(t, "SetMaxKReceipt", 50000.0)
+	db.On("SetDeduction", config.DeductionType.KReceipt, 50000.0).Return()
+	setDeduction(h, c, config.DeductionType.KReceipt)
+	db.AssertCalled(t, "SetDeduction", config.DeductionType.KReceipt, 50000.0)
 
 	err = json.Unmarshal(rec.Body.Bytes(), &body)
 	if err != nil {
@@ -198,7 +312,7 @@ func TestSetMaxKReceiptHandler_InvalidInput(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -213,7 +327,7 @@ func TestSetMaxKReceiptHandler_InvalidInput(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	h.SetMaxKReceiptHandler(c)
+	setDeduction(h, c, config.DeductionType.KReceipt)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
@@ -228,7 +342,7 @@ func TestSetMaxKReceiptHandler_ValueNotInLimit(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -243,7 +357,7 @@ func TestSetMaxKReceiptHandler_ValueNotInLimit(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	h.SetMaxKReceiptHandler(c)
+	setDeduction(h, c, config.DeductionType.KReceipt)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
@@ -258,7 +372,7 @@ func TestSetMaxKReceiptHandler_GetConfigError(t *testing.T) {
 		t.Errorf("failed to marshal body: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(bodyJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -271,15 +385,15 @@ func TestSetMaxKReceiptHandler_GetConfigError(t *testing.T) {
 	}
 
 	h := config.NewHandler(db)
-	db.On("SetMaxKReceipt", 50000.0).Return()
-	h.SetMaxKReceiptHandler(c)
+	db.On("SetDeduction", config.DeductionType.KReceipt, 50000.0).Return()
+	setDeduction(h, c, config.DeductionType.KReceipt)
 
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 }
 
 func TestGetConfigHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		rec := httptest.NewRecorder()
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config")
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -294,7 +408,7 @@ func TestGetConfigHandler(t *testing.T) {
 
 		h := config.NewHandler(db)
 
-		h.GetConfigHandler(c)
+		helper.ErrorHandler(h.GetConfigHandler(c), c)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
 		var body config.Config
@@ -306,7 +420,7 @@ func TestGetConfigHandler(t *testing.T) {
 		assert.Equal(t, 50000.0, body.MaxKReceipt)
 	})
 	t.Run("Failed", func(t *testing.T) {
-		rec := httptest.NewRecorder()
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config")
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -319,8 +433,632 @@ func TestGetConfigHandler(t *testing.T) {
 
 		h := config.NewHandler(db)
 
-		h.GetConfigHandler(c)
+		helper.ErrorHandler(h.GetConfigHandler(c), c)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+	t.Run("Database timeout should return 504", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config")
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{Error: context.DeadlineExceeded})
+
+		helper.ErrorHandler(h.GetConfigHandler(c), c)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	})
+}
+
+func TestListConfigVersionsHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/versions")
+		req := httptest.NewRequest(http.MethodGet, "/config/versions", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Config: config.Config{PersonalDeduction: 60000.0, Version: 2}}
+
+		h := config.NewHandler(db)
+		helper.ErrorHandler(h.ListConfigVersionsHandler(c), c)
+
+		var body []config.ConfigVersion
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, int64(2), body[0].Version)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/versions")
+		req := httptest.NewRequest(http.MethodGet, "/config/versions", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Error: errors.New("failed to list versions")}
+
+		h := config.NewHandler(db)
+		helper.ErrorHandler(h.ListConfigVersionsHandler(c), c)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestGetConfigVersionHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		version  string
+		db       *mockDB
+		expected int
+	}{
+		{"Success", "2", &mockDB{Config: config.Config{PersonalDeduction: 70000.0, Version: 2}}, http.StatusOK},
+		{"Invalid version", "abc", &mockDB{}, http.StatusBadRequest},
+		{"Unknown version", "3", &mockDB{Config: config.Config{Version: 2}}, http.StatusNotFound},
+		{"Database error", "2", &mockDB{Error: errors.New("failed to get version")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/versions/{version}")
+			req := httptest.NewRequest(http.MethodGet, "/config/versions/"+tc.version, nil)
+
+			e := echo.New()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("version")
+			c.SetParamValues(tc.version)
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.GetConfigVersionHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+}
+
+func TestSetPersonalDeductionHandler_RecordsActor(t *testing.T) {
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"amount": 70000}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	c := e.NewContext(req, rec)
+	c.Set(middleware.UsernameKey, "adminTax")
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+	db := &mockDB{Config: config.Config{PersonalDeduction: 70000.0}}
+	db.On("SetDeduction", config.DeductionType.Personal, 70000.0).Return()
+
+	h := config.NewHandler(db)
+	setDeduction(h, c, config.DeductionType.Personal)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, config.Actor{Username: "adminTax", RequestID: "req-1"}, db.Actor)
+}
+
+func TestListAuditHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/audit")
+		req := httptest.NewRequest(http.MethodGet, "/audit?field=kReceipt&from=2024-04-01T00:00:00Z&to=2024-04-02T00:00:00Z&limit=10&offset=5", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Audit: config.AuditPage{
+			Entries: []config.AuditEntry{{ID: 1, Username: "adminTax", Field: "kReceipt", OldValue: []byte("50000"), NewValue: []byte("70000")}},
+			Total:   1,
+		}}
+
+		h := config.NewHandler(db)
+		helper.ErrorHandler(h.ListAuditHandler(c), c)
+
+		var body config.AuditPage
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "adminTax", body.Entries[0].Username)
+		assert.Equal(t, config.AuditFilter{
+			Field:  "kReceipt",
+			From:   time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC),
+			Limit:  10,
+			Offset: 5,
+		}, db.Filter)
+	})
+
+	for _, query := range []string{"from=yesterday", "to=2024-13-01", "limit=0", "offset=abc"} {
+		t.Run("Invalid query "+query, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/audit")
+			req := httptest.NewRequest(http.MethodGet, "/audit?"+query, nil)
+
+			e := echo.New()
+			c := e.NewContext(req, rec)
+
+			h := config.NewHandler(&mockDB{})
+			helper.ErrorHandler(h.ListAuditHandler(c), c)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	t.Run("Failed", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/audit")
+		req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{Error: errors.New("failed to list audit")})
+		helper.ErrorHandler(h.ListAuditHandler(c), c)
+
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
+}
+
+func TestSetDeductionHandler_WithEffectiveFrom(t *testing.T) {
+	effectiveFrom := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	cases := []struct {
+		name    string
+		typ     string
+		changes string
+	}{
+		{"Personal deduction", config.DeductionType.Personal, `{"personalDeduction":70000}`},
+		{"K-Receipt", config.DeductionType.KReceipt, `{"kReceipt":70000}`},
+		{"Donation", config.DeductionType.Donation, `{"limits":{"maxDonation":70000}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name+" should be scheduled", func(t *testing.T) {
+			body := fmt.Sprintf(`{"amount": 70000, "effectiveFrom": %q}`, effectiveFrom.Format(time.RFC3339))
+			rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+
+			db := &mockDB{Config: config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000}}
+
+			h := config.NewHandler(db)
+			setDeduction(h, c, tc.typ)
+
+			var res config.ScheduledChange
+			assert.Equal(t, http.StatusCreated, rec.Code)
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.JSONEq(t, tc.changes, string(res.Changes))
+			assert.True(t, effectiveFrom.Equal(res.EffectiveFrom))
+			assert.Len(t, db.Scheduled, 1)
+			db.AssertNotCalled(t, "SetDeduction", tc.typ, 70000.0)
+		})
+	}
+
+	t.Run("Past effectiveFrom should return 400", func(t *testing.T) {
+		body := fmt.Sprintf(`{"amount": 70000, "effectiveFrom": %q}`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+		rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
+		e := echo.New()
+		e.Validator = helper.NewValidator()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{}
+
+		h := config.NewHandler(db)
+		setDeduction(h, c, config.DeductionType.Personal)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, db.Scheduled)
+	})
+}
+
+func TestScheduleChangeHandler(t *testing.T) {
+	effectiveFrom := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	current := config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000}
+
+	cases := []struct {
+		name     string
+		body     string
+		db       *mockDB
+		expected int
+	}{
+		{"Valid change", fmt.Sprintf(`{"effectiveFrom": %q, "changes": {"personalDeduction": 70000, "kReceipt": 60000}}`, effectiveFrom), &mockDB{Config: current}, http.StatusCreated},
+		{"Missing effectiveFrom", `{"changes": {"personalDeduction": 70000}}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Missing changes", fmt.Sprintf(`{"effectiveFrom": %q}`, effectiveFrom), &mockDB{Config: current}, http.StatusBadRequest},
+		{"Unknown field", fmt.Sprintf(`{"effectiveFrom": %q, "changes": {"unknown": 1}}`, effectiveFrom), &mockDB{Config: current}, http.StatusBadRequest},
+		{"Value out of range", fmt.Sprintf(`{"effectiveFrom": %q, "changes": {"personalDeduction": 5000}}`, effectiveFrom), &mockDB{Config: current}, http.StatusBadRequest},
+		{"Database error", fmt.Sprintf(`{"effectiveFrom": %q, "changes": {"personalDeduction": 70000}}`, effectiveFrom), &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/config/schedule")
+			req := httptest.NewRequest(http.MethodPost, "/config/schedule", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+			c.Set(middleware.UsernameKey, "adminTax")
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.ScheduleChangeHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+}
+
+func TestListScheduledChangesHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/schedule")
+		req := httptest.NewRequest(http.MethodGet, "/config/schedule?status=pending", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Scheduled: []config.ScheduledChange{{ID: 1, Status: config.ScheduleStatus.Pending, Changes: json.RawMessage(`{"kReceipt":70000}`)}}}
+
+		h := config.NewHandler(db)
+		helper.ErrorHandler(h.ListScheduledChangesHandler(c), c)
+
+		var res []config.ScheduledChange
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res, 1)
+	})
+
+	t.Run("Invalid status", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/schedule")
+		req := httptest.NewRequest(http.MethodGet, "/config/schedule?status=unknown", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{})
+		helper.ErrorHandler(h.ListScheduledChangesHandler(c), c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/config/schedule")
+		req := httptest.NewRequest(http.MethodGet, "/config/schedule", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{Error: errors.New("db error")})
+		helper.ErrorHandler(h.ListScheduledChangesHandler(c), c)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestCancelScheduledChangeHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		id       string
+		db       *mockDB
+		expected int
+	}{
+		{"Success", "1", &mockDB{Scheduled: []config.ScheduledChange{{ID: 1, Changes: json.RawMessage(`{"kReceipt": 60000}`), Status: config.ScheduleStatus.Pending}}}, http.StatusOK},
+		{"Invalid ID", "abc", &mockDB{}, http.StatusBadRequest},
+		{"Not found", "2", &mockDB{}, http.StatusNotFound},
+		{"Not pending", "1", &mockDB{Error: config.ErrScheduledChangeNotPending}, http.StatusConflict},
+		{"Database error", "1", &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodDelete, "/admin/config/schedule/{id}")
+			req := httptest.NewRequest(http.MethodDelete, "/config/schedule/"+tc.id, nil)
+
+			e := echo.New()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tc.id)
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.CancelScheduledChangeHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+}
+
+func TestReplaceConfigHandler(t *testing.T) {
+	brackets := `[{"level": "0-150,000", "min": 0, "max": 150000, "rate": 0}, {"level": "150,001 ขึ้นไป", "min": 150000, "rate": 0.1}], "limits": {"maxDonation": 100000, "personalDeduction": {"min": 10000, "max": 100000}, "kReceipt": {"min": 0, "max": 100000}}`
+
+	cases := []struct {
+		name     string
+		body     string
+		db       *mockDB
+		expected int
+	}{
+		{"Valid config", fmt.Sprintf(`{"personalDeduction": 70000, "kReceipt": 80000, "taxBrackets": %s}`, brackets), &mockDB{Config: config.Config{Version: 1}}, http.StatusOK},
+		{"Missing field", `{"personalDeduction": 70000, "kReceipt": 80000}`, &mockDB{}, http.StatusBadRequest},
+		{"Empty brackets", `{"personalDeduction": 70000, "kReceipt": 80000, "taxBrackets": [], "limits": {"maxDonation": 100000, "personalDeduction": {"min": 10000, "max": 100000}, "kReceipt": {"min": 0, "max": 100000}}}`, &mockDB{}, http.StatusBadRequest},
+		{"Personal deduction out of range", fmt.Sprintf(`{"personalDeduction": 5000, "kReceipt": 80000, "taxBrackets": %s}`, brackets), &mockDB{}, http.StatusBadRequest},
+		{"K-Receipt out of range", fmt.Sprintf(`{"personalDeduction": 70000, "kReceipt": 200000, "taxBrackets": %s}`, brackets), &mockDB{}, http.StatusBadRequest},
+		{"Invalid brackets", `{"personalDeduction": 70000, "kReceipt": 80000, "taxBrackets": [{"level": "a", "min": 100, "rate": 0.1}], "limits": {"maxDonation": 0, "personalDeduction": {"min": 0, "max": 100000}, "kReceipt": {"min": 0, "max": 100000}}}`, &mockDB{}, http.StatusBadRequest},
+		{"Invalid JSON", `{"personalDeduction": "70000"}`, &mockDB{}, http.StatusBadRequest},
+		{"Database error", fmt.Sprintf(`{"personalDeduction": 70000, "kReceipt": 80000, "taxBrackets": %s}`, brackets), &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPut, "/admin/config")
+			req := httptest.NewRequest(http.MethodPut, "/config", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+			c.Set(middleware.UsernameKey, "adminTax")
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.ReplaceConfigHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				var res config.Config
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Equal(t, 70000.0, res.PersonalDeduction)
+				assert.Equal(t, 80000.0, res.MaxKReceipt)
+				assert.Len(t, res.TaxBrackets, 2)
+				assert.Equal(t, "adminTax", tc.db.Actor.Username)
+			}
+		})
+	}
+}
+
+func TestPatchConfigHandler(t *testing.T) {
+	current := config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000, TaxBrackets: config.DefaultTaxBrackets(), Version: 1}
+
+	cases := []struct {
+		name     string
+		body     string
+		db       *mockDB
+		expected int
+	}{
+		{"Valid patch", `{"kReceipt": 80000}`, &mockDB{Config: current}, http.StatusOK},
+		{"Out of range", `{"personalDeduction": 5000}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Unknown field", `{"unknown": 1}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Version", `{"version": 5}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Not an object", `[]`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Empty brackets", `{"taxBrackets": []}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Database error", `{"kReceipt": 80000}`, &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPatch, "/admin/config")
+			req := httptest.NewRequest(http.MethodPatch, "/config", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.PatchConfigHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				var res config.Config
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Equal(t, 60000.0, res.PersonalDeduction)
+				assert.Equal(t, 80000.0, res.MaxKReceipt)
+				assert.Equal(t, int64(2), res.Version)
+			}
+		})
+	}
+}
+
+func TestSetDeductionHandler_Donation(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		db       *mockDB
+		expected int
+	}{
+		{"Valid amount", `{"amount": 50000}`, &mockDB{}, http.StatusOK},
+		{"Negative amount", `{"amount": -1}`, &mockDB{}, http.StatusBadRequest},
+		{"Missing amount", `{}`, &mockDB{}, http.StatusBadRequest},
+		{"Database error", `{"amount": 50000}`, &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+			req := httptest.NewRequest(http.MethodPost, "/deductions/donation", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+
+			h := config.NewHandler(tc.db)
+			tc.db.On("SetDeduction", config.DeductionType.Donation, 50000.0).Return()
+			setDeduction(h, c, config.DeductionType.Donation)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				assert.JSONEq(t, `{"maxDonation": 50000, "version": 0}`, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSetDeductionHandler_UnknownType(t *testing.T) {
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+	req := httptest.NewRequest(http.MethodPost, "/deductions/unknown", bytes.NewBufferString(`{"amount": 50000}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	c := e.NewContext(req, rec)
+
+	h := config.NewHandler(&mockDB{})
+	setDeduction(h, c, "unknown")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestListDeductionsHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/deductions")
+		req := httptest.NewRequest(http.MethodGet, "/deductions", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		db := &mockDB{Config: config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000}}
+		h := config.NewHandler(db)
+		helper.ErrorHandler(h.ListDeductionsHandler(c), c)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[
+			{"type": "personal", "amount": 60000, "min": 10000, "max": 100000},
+			{"type": "k-receipt", "amount": 50000, "min": 0, "max": 100000},
+			{"type": "donation", "amount": 100000, "min": 0}
+		]`, rec.Body.String())
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/deductions")
+		req := httptest.NewRequest(http.MethodGet, "/deductions", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{Error: errors.New("db error")})
+		helper.ErrorHandler(h.ListDeductionsHandler(c), c)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestSetDeductionHandler_UsesStoredLimits(t *testing.T) {
+	l := config.DefaultLimits()
+	l.PersonalDeduction = config.Range{Min: 10000, Max: 200000}
+	db := &mockDB{Config: config.Config{PersonalDeduction: 60000, DeductionLimits: &l}}
+
+	rec := openapitest.NewRecorder(t, http.MethodPost, "/admin/deductions/{type}")
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"amount": 150000}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	c := e.NewContext(req, rec)
+
+	h := config.NewHandler(db)
+	db.On("SetDeduction", config.DeductionType.Personal, 150000.0).Return()
+	setDeduction(h, c, config.DeductionType.Personal)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	db.AssertCalled(t, "SetDeduction", config.DeductionType.Personal, 150000.0)
+}
+
+func TestGetLimitsHandler(t *testing.T) {
+	t.Run("Unset limits should return defaults", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/limits")
+		req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{})
+		helper.ErrorHandler(h.GetLimitsHandler(c), c)
+
+		var res config.Limits
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, config.DefaultLimits(), res)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/limits")
+		req := httptest.NewRequest(http.MethodGet, "/limits", nil)
+
+		e := echo.New()
+		c := e.NewContext(req, rec)
+
+		h := config.NewHandler(&mockDB{Error: errors.New("db error")})
+		helper.ErrorHandler(h.GetLimitsHandler(c), c)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestConfigErrorsShouldBeTranslated(t *testing.T) {
+	cases := []struct {
+		name     string
+		path     string
+		body     string
+		handler  func(config.Handler) echo.HandlerFunc
+		expected string
+	}{
+		{"Limits", "/admin/limits", `{"maxDonation": 50000, "personalDeduction": {"min": 20000, "max": 10000}, "kReceipt": {"min": 0, "max": 100000}}`,
+			func(h config.Handler) echo.HandlerFunc { return h.SetLimitsHandler }, "ค่าสูงสุดของค่าลดหย่อนส่วนตัวต้องไม่น้อยกว่าค่าต่ำสุด"},
+		{"Config", "/admin/config", `{"personalDeduction": 70000, "kReceipt": 80000, "taxBrackets": [{"level": "a", "min": 100, "rate": 0.1}], "limits": {"maxDonation": 0, "personalDeduction": {"min": 0, "max": 100000}, "kReceipt": {"min": 0, "max": 100000}}}`,
+			func(h config.Handler) echo.HandlerFunc { return h.ReplaceConfigHandler }, `ขั้นบันไดภาษี "a" ต้องเริ่มที่ 0`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPut, tc.path)
+			req := httptest.NewRequest(http.MethodPut, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("Accept-Language", "th")
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+
+			helper.ErrorHandler(tc.handler(config.NewHandler(&mockDB{}))(c), c)
+
+			var res helper.Problem
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, tc.expected, res.Detail)
+		})
+	}
+}
+
+func TestSetLimitsHandler(t *testing.T) {
+	current := config.Config{PersonalDeduction: 60000, MaxKReceipt: 50000}
+
+	cases := []struct {
+		name     string
+		body     string
+		db       *mockDB
+		expected int
+	}{
+		{"Valid limits", `{"maxDonation": 50000, "personalDeduction": {"min": 10000, "max": 200000}, "kReceipt": {"min": 0, "max": 100000}}`, &mockDB{Config: current}, http.StatusOK},
+		{"Maximum below minimum", `{"maxDonation": 50000, "personalDeduction": {"min": 20000, "max": 10000}, "kReceipt": {"min": 0, "max": 100000}}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Current value outside limits", `{"maxDonation": 50000, "personalDeduction": {"min": 10000, "max": 50000}, "kReceipt": {"min": 0, "max": 100000}}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Invalid JSON", `{"maxDonation": "a lot"}`, &mockDB{Config: current}, http.StatusBadRequest},
+		{"Database error", `{"maxDonation": 50000, "personalDeduction": {"min": 10000, "max": 200000}, "kReceipt": {"min": 0, "max": 100000}}`, &mockDB{Error: errors.New("db error")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := openapitest.NewRecorder(t, http.MethodPut, "/admin/limits")
+			req := httptest.NewRequest(http.MethodPut, "/limits", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			e := echo.New()
+			e.Validator = helper.NewValidator()
+			c := e.NewContext(req, rec)
+
+			h := config.NewHandler(tc.db)
+			helper.ErrorHandler(h.SetLimitsHandler(c), c)
+
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
 }
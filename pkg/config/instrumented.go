@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/jaiieth/assessment-tax/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/jaiieth/assessment-tax/pkg/config")
+
+// Instrumented is a Database that traces every query, records how long config
+// reads take and counts the changes made through it. It wraps the store under
+// the cache, so reads answered by the cache are not counted.
+type Instrumented struct {
+	Database
+}
+
+func NewInstrumented(db Database) Instrumented {
+	return Instrumented{Database: db}
+}
+
+// startSpan starts the span of a query. Call the returned function with the
+// query's error when it is done.
+func startSpan(ctx context.Context, name string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, "config."+name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, func(err *error) { tracing.End(span, err) }
+}
+
+func observeRead(operation string, start time.Time) {
+	metrics.ConfigReadDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func countChange(operation string, err *error) {
+	status := "ok"
+	if *err != nil {
+		status = "error"
+	}
+	metrics.ConfigChanges.WithLabelValues(operation, status).Inc()
+}
+
+func (i Instrumented) GetConfig(ctx context.Context) (c Config, err error) {
+	ctx, done := startSpan(ctx, "GetConfig")
+	defer done(&err)
+	defer observeRead("get_config", time.Now())
+
+	return i.Database.GetConfig(ctx)
+}
+
+func (i Instrumented) GetConfigVersion(ctx context.Context, version int64) (c Config, err error) {
+	ctx, done := startSpan(ctx, "GetConfigVersion")
+	defer done(&err)
+	defer observeRead("get_config_version", time.Now())
+
+	return i.Database.GetConfigVersion(ctx, version)
+}
+
+func (i Instrumented) GetConfigAt(ctx context.Context, t time.Time) (c Config, err error) {
+	ctx, done := startSpan(ctx, "GetConfigAt")
+	defer done(&err)
+	defer observeRead("get_config_at", time.Now())
+
+	return i.Database.GetConfigAt(ctx, t)
+}
+
+func (i Instrumented) ListConfigVersions(ctx context.Context) (versions []ConfigVersion, err error) {
+	ctx, done := startSpan(ctx, "ListConfigVersions")
+	defer done(&err)
+
+	return i.Database.ListConfigVersions(ctx)
+}
+
+func (i Instrumented) ListAudit(ctx context.Context, f AuditFilter) (page AuditPage, err error) {
+	ctx, done := startSpan(ctx, "ListAudit")
+	defer done(&err)
+
+	return i.Database.ListAudit(ctx, f)
+}
+
+func (i Instrumented) ListScheduledChanges(ctx context.Context, status string) (changes []ScheduledChange, err error) {
+	ctx, done := startSpan(ctx, "ListScheduledChanges")
+	defer done(&err)
+
+	return i.Database.ListScheduledChanges(ctx, status)
+}
+
+func (i Instrumented) SetDeduction(ctx context.Context, t string, n float64, a Actor) (c Config, err error) {
+	ctx, done := startSpan(ctx, "SetDeduction")
+	defer done(&err)
+	defer countChange("set_deduction", &err)
+
+	return i.Database.SetDeduction(ctx, t, n, a)
+}
+
+func (i Instrumented) SetLimits(ctx context.Context, l Limits, a Actor) (c Config, err error) {
+	ctx, done := startSpan(ctx, "SetLimits")
+	defer done(&err)
+	defer countChange("set_limits", &err)
+
+	return i.Database.SetLimits(ctx, l, a)
+}
+
+func (i Instrumented) ReplaceConfig(ctx context.Context, next Config, a Actor) (c Config, err error) {
+	ctx, done := startSpan(ctx, "ReplaceConfig")
+	defer done(&err)
+	defer countChange("replace_config", &err)
+
+	return i.Database.ReplaceConfig(ctx, next, a)
+}
+
+func (i Instrumented) PatchConfig(ctx context.Context, patch json.RawMessage, a Actor) (c Config, err error) {
+	ctx, done := startSpan(ctx, "PatchConfig")
+	defer done(&err)
+	defer countChange("patch_config", &err)
+
+	return i.Database.PatchConfig(ctx, patch, a)
+}
+
+func (i Instrumented) ScheduleChange(ctx context.Context, sc ScheduledChange, a Actor) (_ ScheduledChange, err error) {
+	ctx, done := startSpan(ctx, "ScheduleChange")
+	defer done(&err)
+	defer countChange("schedule_change", &err)
+
+	return i.Database.ScheduleChange(ctx, sc, a)
+}
+
+func (i Instrumented) ApplyScheduledChanges(ctx context.Context) (c Config, err error) {
+	ctx, done := startSpan(ctx, "ApplyScheduledChanges")
+	defer done(&err)
+
+	return i.Database.ApplyScheduledChanges(ctx)
+}
+
+func (i Instrumented) CancelScheduledChange(ctx context.Context, id int64, a Actor) (sc ScheduledChange, err error) {
+	ctx, done := startSpan(ctx, "CancelScheduledChange")
+	defer done(&err)
+	defer countChange("cancel_scheduled_change", &err)
+
+	return i.Database.CancelScheduledChange(ctx, id, a)
+}
@@ -0,0 +1,54 @@
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrumented(t *testing.T) {
+	admin := config.Actor{Username: "adminTax"}
+
+	t.Run("Changes should be counted by status", func(t *testing.T) {
+		ok := metrics.ConfigChanges.WithLabelValues("set_deduction", "ok")
+		failed := metrics.ConfigChanges.WithLabelValues("set_deduction", "error")
+		okBefore, failedBefore := testutil.ToFloat64(ok), testutil.ToFloat64(failed)
+		db := config.NewInstrumented(config.NewMemory())
+
+		db.SetDeduction(context.Background(), config.DeductionType.Personal, 70000, admin)
+		db.SetDeduction(context.Background(), config.DeductionType.Personal, 500, admin)
+
+		assert.Equal(t, okBefore+1, testutil.ToFloat64(ok))
+		assert.Equal(t, failedBefore+1, testutil.ToFloat64(failed))
+	})
+
+	t.Run("Reads should be timed", func(t *testing.T) {
+		db := config.NewInstrumented(config.NewMemory())
+
+		c, err := db.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), c.Version)
+		assert.Equal(t, 1, testutil.CollectAndCount(metrics.ConfigReadDuration.MustCurryWith(map[string]string{"operation": "get_config"})))
+	})
+	t.Run("Queries should be traced", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		db := config.NewInstrumented(config.NewMemory())
+
+		db.GetConfigVersion(context.Background(), 99)
+
+		spans := recorder.Ended()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "config.GetConfigVersion", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+	})
+}
@@ -0,0 +1,458 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// seedEffectiveAt is when the first config version takes effect, same as the
+// version created by the migrations.
+var seedEffectiveAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+
+// Memory is a Database kept in memory, for running the API without Postgres.
+// When Path is set the current config is loaded from and saved to that JSON
+// or YAML file; versions, the audit log and scheduled changes are not.
+type Memory struct {
+	Path string
+
+	mu    sync.Mutex
+	state memoryState
+}
+
+type memoryState struct {
+	current  Config
+	versions []ConfigVersion
+	audit    []AuditEntry
+	schedule []ScheduledChange
+}
+
+func (s memoryState) clone() memoryState {
+	s.current = s.current.clone()
+	s.versions = append([]ConfigVersion{}, s.versions...)
+	s.audit = append([]AuditEntry{}, s.audit...)
+	s.schedule = append([]ScheduledChange{}, s.schedule...)
+	return s
+}
+
+// NewMemory returns a store whose first version is the default config.
+func NewMemory() *Memory {
+	return newMemory(DefaultConfig())
+}
+
+// NewFileMemory returns a store backed by the config file at path, which is
+// created with the default config if it does not exist.
+func NewFileMemory(path string) (*Memory, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		m := NewMemory()
+		m.Path = path
+		return m, m.save(m.state.current)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := decodeConfigFile(path, b)
+	if err != nil {
+		return nil, fmt.Errorf("err: invalid config file %s: %w", path, err)
+	}
+
+	m := newMemory(c)
+	m.Path = path
+	return m, nil
+}
+
+func newMemory(c Config) *Memory {
+	c.Version = 1
+	return &Memory{state: memoryState{
+		current:  c,
+		versions: []ConfigVersion{{Version: 1, EffectiveAt: seedEffectiveAt, Config: c.clone()}},
+	}}
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func decodeConfigFile(path string, b []byte) (Config, error) {
+	if isYAML(path) {
+		var doc interface{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return Config{}, err
+		}
+		var err error
+		if b, err = json.Marshal(doc); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+	c.Version = 0
+	c = c.withDefaults()
+
+	return c, c.Validate()
+}
+
+// save writes the config to Path, replacing the file only once it is
+// completely written.
+func (m *Memory) save(c Config) error {
+	if m.Path == "" {
+		return nil
+	}
+
+	c.Version = 0
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if isYAML(m.Path) {
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		if b, err = yaml.Marshal(doc); err != nil {
+			return err
+		}
+	}
+
+	tmp := m.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.Path)
+}
+
+// GetConfig works like Postgres.GetConfig and never changes the state.
+func (m *Memory) GetConfig(ctx context.Context) (Config, error) {
+	if err := ctx.Err(); err != nil {
+		return Config{}, err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	c := m.state.current.clone()
+	due := false
+	for _, sc := range m.state.pending() {
+		due = due || !sc.EffectiveFrom.After(now)
+	}
+	m.mu.Unlock()
+
+	if !due {
+		return c, nil
+	}
+	c, err := projectConfig(ctx, c, m.ListScheduledChanges, now)
+	c.Version = 0
+	return c, err
+}
+
+func (m *Memory) ApplyScheduledChanges(ctx context.Context) (Config, error) {
+	return m.update(ctx, Actor{}, nil)
+}
+
+func (m *Memory) GetConfigVersion(ctx context.Context, version int64) (Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.state.versions {
+		if v.Version == version {
+			return v.Config.clone(), nil
+		}
+	}
+	return Config{}, ErrConfigVersionNotFound
+}
+
+func (m *Memory) ListConfigVersions(ctx context.Context) ([]ConfigVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := []ConfigVersion{}
+	for i := len(m.state.versions) - 1; i >= 0; i-- {
+		versions = append(versions, m.state.versions[i])
+	}
+	return versions, nil
+}
+
+func (m *Memory) SetDeduction(ctx context.Context, t string, n float64, a Actor) (Config, error) {
+	if _, err := GetDeductionRule(t); err != nil {
+		return Config{}, err
+	}
+
+	return m.update(ctx, a, func(c *Config) error {
+		if err := c.SetDeduction(t, n); err != nil {
+			return err
+		}
+		return c.validate()
+	})
+}
+
+func (m *Memory) SetLimits(ctx context.Context, l Limits, a Actor) (Config, error) {
+	return m.update(ctx, a, func(c *Config) error {
+		c.DeductionLimits = &l
+		return c.validate()
+	})
+}
+
+func (m *Memory) ReplaceConfig(ctx context.Context, next Config, a Actor) (Config, error) {
+	return m.update(ctx, a, func(c *Config) error {
+		*c = next.withDefaults().clone()
+		return c.validate()
+	})
+}
+
+func (m *Memory) PatchConfig(ctx context.Context, patch json.RawMessage, a Actor) (Config, error) {
+	return m.update(ctx, a, func(c *Config) error {
+		next, err := c.Apply(patch)
+		if err != nil {
+			return InvalidConfigError{err}
+		}
+		*c = next
+		return c.validate()
+	})
+}
+
+// update works like Postgres.update: due scheduled changes are applied first,
+// and nothing is kept unless every step succeeds.
+func (m *Memory) update(ctx context.Context, a Actor, apply func(*Config) error) (Config, error) {
+	if err := ctx.Err(); err != nil {
+		return Config{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.state.clone()
+	changed, err := s.applyDueChanges(time.Now())
+	if err != nil {
+		return Config{}, err
+	}
+
+	if apply != nil {
+		next := s.current.clone()
+		if err := apply(&next); err != nil {
+			return Config{}, err
+		}
+		if err := checkPending(next, s.pending()); err != nil {
+			return Config{}, err
+		}
+		if err := s.saveVersion(next, a, time.Now()); err != nil {
+			return Config{}, err
+		}
+		changed = true
+	}
+
+	if changed {
+		if err := m.save(s.current); err != nil {
+			return Config{}, err
+		}
+		m.state = s
+	}
+	return m.state.current.clone(), nil
+}
+
+// applyDueChanges works like the Postgres one: invalid changes are marked
+// failed and skipped.
+func (s *memoryState) applyDueChanges(now time.Time) (bool, error) {
+	sortSchedule(s.schedule)
+
+	changed := false
+	for i, sc := range s.schedule {
+		if sc.Status != ScheduleStatus.Pending || sc.EffectiveFrom.After(now) {
+			continue
+		}
+
+		next, err := s.current.applyScheduled(sc)
+		if err != nil {
+			s.schedule[i].Status = ScheduleStatus.Failed
+			s.schedule[i].Failure = err.Error()
+			changed = true
+			continue
+		}
+		if err := s.saveVersion(next, Actor{Username: sc.Username, RequestID: sc.RequestID}, sc.EffectiveFrom); err != nil {
+			return false, err
+		}
+
+		s.schedule[i].Status = ScheduleStatus.Applied
+		s.schedule[i].AppliedVersion = s.current.Version
+		changed = true
+	}
+	return changed, nil
+}
+
+// pending returns the pending changes in the order they take effect.
+func (s memoryState) pending() []ScheduledChange {
+	pending := []ScheduledChange{}
+	for _, sc := range s.schedule {
+		if sc.Status == ScheduleStatus.Pending {
+			pending = append(pending, sc)
+		}
+	}
+	sortSchedule(pending)
+	return pending
+}
+
+func (s *memoryState) saveVersion(next Config, a Actor, effectiveAt time.Time) error {
+	entries, err := diffConfig(s.current, next, a)
+	if err != nil {
+		return err
+	}
+
+	next.Version = int64(len(s.versions)) + 1
+	s.versions = append(s.versions, ConfigVersion{Version: next.Version, EffectiveAt: effectiveAt, Config: next.clone()})
+
+	now := time.Now()
+	for _, e := range entries {
+		e.ID = int64(len(s.audit)) + 1
+		e.Version = next.Version
+		e.ChangedAt = now
+		s.audit = append(s.audit, e)
+	}
+
+	s.current = next
+	return nil
+}
+
+func (m *Memory) ListAudit(ctx context.Context, f AuditFilter) (AuditPage, error) {
+	f = f.normalize()
+
+	m.mu.Lock()
+	matched := []AuditEntry{}
+	for _, e := range m.state.audit {
+		if f.match(e) {
+			matched = append(matched, e)
+		}
+	}
+	m.mu.Unlock()
+
+	// Newest first, same as the Postgres implementation
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].ChangedAt.Equal(matched[j].ChangedAt) {
+			return matched[i].ID > matched[j].ID
+		}
+		return matched[i].ChangedAt.After(matched[j].ChangedAt)
+	})
+
+	page := AuditPage{Entries: []AuditEntry{}, Total: len(matched), Limit: f.Limit, Offset: f.Offset}
+	if f.Offset < len(matched) {
+		end := min(f.Offset+f.Limit, len(matched))
+		page.Entries = matched[f.Offset:end]
+	}
+	return page, nil
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	if f.Field != "" && e.Field != f.Field {
+		return false
+	}
+	if !f.From.IsZero() && e.ChangedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.ChangedAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+func (m *Memory) GetConfigAt(ctx context.Context, t time.Time) (Config, error) {
+	c, err := m.GetConfig(ctx)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if t.After(time.Now()) {
+		return projectConfig(ctx, c, m.ListScheduledChanges, t)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *ConfigVersion
+	for i, v := range m.state.versions {
+		if v.EffectiveAt.After(t) {
+			continue
+		}
+		if found == nil || !v.EffectiveAt.Before(found.EffectiveAt) {
+			found = &m.state.versions[i]
+		}
+	}
+	if found == nil {
+		return Config{}, ErrNoConfigAt
+	}
+	return found.Config.clone(), nil
+}
+
+func (m *Memory) ScheduleChange(ctx context.Context, sc ScheduledChange, a Actor) (ScheduledChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sc = ScheduledChange{
+		ID:            int64(len(m.state.schedule)) + 1,
+		Changes:       append(json.RawMessage{}, sc.Changes...),
+		EffectiveFrom: sc.EffectiveFrom,
+		Status:        ScheduleStatus.Pending,
+		Username:      a.Username,
+		RequestID:     a.RequestID,
+		CreatedAt:     time.Now(),
+	}
+	m.state.schedule = append(m.state.schedule, sc)
+	return sc, nil
+}
+
+func (m *Memory) ListScheduledChanges(ctx context.Context, status string) ([]ScheduledChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := []ScheduledChange{}
+	for _, sc := range m.state.schedule {
+		if status == "" || sc.Status == status {
+			changes = append(changes, sc)
+		}
+	}
+	sortSchedule(changes)
+	return changes, nil
+}
+
+func (m *Memory) CancelScheduledChange(ctx context.Context, id int64, a Actor) (ScheduledChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, sc := range m.state.schedule {
+		if sc.ID != id {
+			continue
+		}
+		if sc.Status != ScheduleStatus.Pending {
+			return ScheduledChange{}, ErrScheduledChangeNotPending
+		}
+		now := time.Now()
+		m.state.schedule[i].Status = ScheduleStatus.Cancelled
+		m.state.schedule[i].CancelledBy = a.Username
+		m.state.schedule[i].CancelledAt = &now
+		return m.state.schedule[i], nil
+	}
+	return ScheduledChange{}, ErrScheduledChangeNotFound
+}
+
+func sortSchedule(changes []ScheduledChange) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].EffectiveFrom.Equal(changes[j].EffectiveFrom) {
+			return changes[i].ID < changes[j].ID
+		}
+		return changes[i].EffectiveFrom.Before(changes[j].EffectiveFrom)
+	})
+}
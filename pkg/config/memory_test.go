@@ -0,0 +1,332 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	admin := config.Actor{Username: "adminTax", RequestID: "req-1"}
+
+	t.Run("New store should start with the default config", func(t *testing.T) {
+		m := config.NewMemory()
+
+		c, err := m.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, c.PersonalDeduction)
+		assert.Equal(t, int64(1), c.Version)
+	})
+
+	t.Run("Change should add a version and audit entries", func(t *testing.T) {
+		m := config.NewMemory()
+
+		c, err := m.SetDeduction(context.Background(), config.DeductionType.Personal, 70000, admin)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, c.PersonalDeduction)
+		assert.Equal(t, int64(2), c.Version)
+
+		old, err := m.GetConfigVersion(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, old.PersonalDeduction)
+
+		versions, _ := m.ListConfigVersions(context.Background())
+		assert.Len(t, versions, 2)
+		assert.Equal(t, int64(2), versions[0].Version)
+
+		page, _ := m.ListAudit(context.Background(), config.AuditFilter{Field: "personalDeduction"})
+		assert.Equal(t, 1, page.Total)
+		assert.Equal(t, "adminTax", page.Entries[0].Username)
+		assert.Equal(t, json.RawMessage("70000"), page.Entries[0].NewValue)
+		assert.Equal(t, int64(2), page.Entries[0].Version)
+	})
+
+	t.Run("Invalid change should not be kept", func(t *testing.T) {
+		m := config.NewMemory()
+
+		_, err := m.SetDeduction(context.Background(), config.DeductionType.Personal, 5000, admin)
+
+		var invalid config.InvalidConfigError
+		assert.ErrorAs(t, err, &invalid)
+		c, _ := m.GetConfig(context.Background())
+		assert.Equal(t, int64(1), c.Version)
+		page, _ := m.ListAudit(context.Background(), config.AuditFilter{})
+		assert.Equal(t, 0, page.Total)
+	})
+
+	t.Run("Due scheduled change should be read without being applied", func(t *testing.T) {
+		m := config.NewMemory()
+		effectiveFrom := time.Now().Add(-time.Minute)
+
+		_, err := m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: effectiveFrom}, admin)
+		assert.NoError(t, err)
+
+		c, err := m.GetConfig(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, c.MaxKReceipt)
+		assert.Equal(t, int64(0), c.Version)
+		versions, _ := m.ListConfigVersions(context.Background())
+		assert.Len(t, versions, 1)
+		pending, _ := m.ListScheduledChanges(context.Background(), config.ScheduleStatus.Pending)
+		assert.Len(t, pending, 1)
+	})
+
+	t.Run("Applying due scheduled changes should give them a version", func(t *testing.T) {
+		m := config.NewMemory()
+		effectiveFrom := time.Now().Add(-time.Minute)
+		m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: effectiveFrom}, admin)
+
+		_, err := m.ApplyScheduledChanges(context.Background())
+
+		assert.NoError(t, err)
+		c, _ := m.GetConfig(context.Background())
+		assert.Equal(t, 70000.0, c.MaxKReceipt)
+		assert.Equal(t, int64(2), c.Version)
+		applied, _ := m.ListScheduledChanges(context.Background(), config.ScheduleStatus.Applied)
+		assert.Len(t, applied, 1)
+		assert.Equal(t, int64(2), applied[0].AppliedVersion)
+	})
+
+	t.Run("Future config should include pending changes", func(t *testing.T) {
+		m := config.NewMemory()
+		effectiveFrom := time.Now().Add(24 * time.Hour)
+		m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"personalDeduction":70000}`), EffectiveFrom: effectiveFrom}, admin)
+
+		now, _ := m.GetConfigAt(context.Background(), time.Now())
+		later, err := m.GetConfigAt(context.Background(), effectiveFrom)
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, now.PersonalDeduction)
+		assert.Equal(t, 70000.0, later.PersonalDeduction)
+	})
+
+	t.Run("Config before the first version should not exist", func(t *testing.T) {
+		m := config.NewMemory()
+
+		_, err := m.GetConfigAt(context.Background(), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		assert.ErrorIs(t, err, config.ErrNoConfigAt)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		m := config.NewMemory()
+		sc, _ := m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: time.Now().Add(time.Hour)}, admin)
+
+		cancelled, err := m.CancelScheduledChange(context.Background(), sc.ID, admin)
+		assert.NoError(t, err)
+		assert.Equal(t, config.ScheduleStatus.Cancelled, cancelled.Status)
+		assert.Equal(t, admin.Username, cancelled.CancelledBy)
+		assert.NotNil(t, cancelled.CancelledAt)
+
+		_, err = m.CancelScheduledChange(context.Background(), sc.ID, admin)
+		assert.ErrorIs(t, err, config.ErrScheduledChangeNotPending)
+
+		_, err = m.CancelScheduledChange(context.Background(), 99, admin)
+		assert.ErrorIs(t, err, config.ErrScheduledChangeNotFound)
+	})
+
+	t.Run("Due change should be cancellable until it is applied", func(t *testing.T) {
+		m := config.NewMemory()
+		sc, _ := m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: time.Now().Add(-time.Second)}, admin)
+
+		cancelled, err := m.CancelScheduledChange(context.Background(), sc.ID, admin)
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.ScheduleStatus.Cancelled, cancelled.Status)
+		c, _ := m.ApplyScheduledChanges(context.Background())
+		assert.Equal(t, config.DEFAULT_MAX_K_RECEIPT, c.MaxKReceipt)
+	})
+}
+
+func TestMemoryScheduledChangeOutOfLimits(t *testing.T) {
+	admin := config.Actor{Username: "adminTax", RequestID: "req-1"}
+	lower := config.DefaultLimits()
+	lower.PersonalDeduction.Max = 80000
+
+	t.Run("Lowering the limits below a pending change should fail", func(t *testing.T) {
+		m := config.NewMemory()
+		sc, _ := m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"personalDeduction":90000}`), EffectiveFrom: time.Now().Add(time.Hour)}, admin)
+
+		_, err := m.SetLimits(context.Background(), lower, admin)
+
+		var invalid config.InvalidConfigError
+		assert.ErrorAs(t, err, &invalid)
+		c, _ := m.GetConfig(context.Background())
+		assert.Equal(t, config.DefaultLimits(), c.Limits())
+
+		_, err = m.CancelScheduledChange(context.Background(), sc.ID, admin)
+		assert.NoError(t, err)
+		_, err = m.SetLimits(context.Background(), lower, admin)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Due change out of the limits should fail without blocking writes", func(t *testing.T) {
+		m := config.NewMemory()
+		_, err := m.SetLimits(context.Background(), lower, admin)
+		assert.NoError(t, err)
+		// Scheduled before the limits were lowered, so never checked against them
+		sc, _ := m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"personalDeduction":90000}`), EffectiveFrom: time.Now().Add(-time.Second)}, admin)
+
+		read, err := m.GetConfig(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, read.PersonalDeduction)
+
+		c, err := m.ApplyScheduledChanges(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, config.DEFAULT_PERSONAL_DEDUCTION, c.PersonalDeduction)
+		assert.NoError(t, c.Validate())
+
+		failed, _ := m.ListScheduledChanges(context.Background(), config.ScheduleStatus.Failed)
+		assert.Len(t, failed, 1)
+		assert.Equal(t, sc.ID, failed[0].ID)
+		assert.Equal(t, "Personal deduction must be between 10000 and 80000", failed[0].Failure)
+
+		c, err = m.SetDeduction(context.Background(), config.DeductionType.Personal, 70000, admin)
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, c.PersonalDeduction)
+	})
+}
+
+func TestFileMemory(t *testing.T) {
+	admin := config.Actor{Username: "adminTax"}
+
+	for _, name := range []string{"config.json", "config.yaml"} {
+		t.Run("Changes to "+name+" should be kept across restarts", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+
+			m, err := config.NewFileMemory(path)
+			assert.NoError(t, err)
+			assert.FileExists(t, path)
+
+			_, err = m.SetDeduction(context.Background(), config.DeductionType.KReceipt, 70000, admin)
+			assert.NoError(t, err)
+
+			restarted, err := config.NewFileMemory(path)
+			assert.NoError(t, err)
+			c, _ := restarted.GetConfig(context.Background())
+			assert.Equal(t, 70000.0, c.MaxKReceipt)
+			assert.Equal(t, config.DefaultTaxBrackets(), c.TaxBrackets)
+		})
+	}
+
+	t.Run("YAML file should be read", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		os.WriteFile(path, []byte("personalDeduction: 80000\nkReceipt: 20000\n"), 0o644)
+
+		m, err := config.NewFileMemory(path)
+
+		assert.NoError(t, err)
+		c, _ := m.GetConfig(context.Background())
+		assert.Equal(t, 80000.0, c.PersonalDeduction)
+		assert.Equal(t, 20000.0, c.MaxKReceipt)
+		assert.Equal(t, config.DefaultLimits(), c.Limits())
+	})
+
+	invalid := map[string]string{
+		"Unknown field":   `{"personalDeduction": 60000, "unknown": 1}`,
+		"Out of limits":   `{"personalDeduction": 500}`,
+		"Not a JSON file": `personalDeduction: 60000`,
+	}
+	for name, content := range invalid {
+		t.Run(name+" should return error", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			os.WriteFile(path, []byte(content), 0o644)
+
+			_, err := config.NewFileMemory(path)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("Memory store", func(t *testing.T) {
+		t.Setenv("CONFIG_STORE", "memory")
+		t.Setenv("CONFIG_FILE", "")
+
+		db, err := config.Open()
+
+		assert.NoError(t, err)
+		assert.IsType(t, &config.Memory{}, db)
+	})
+
+	t.Run("File store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		t.Setenv("CONFIG_STORE", "memory")
+		t.Setenv("CONFIG_FILE", path)
+
+		db, err := config.Open()
+
+		assert.NoError(t, err)
+		assert.Equal(t, path, db.(*config.Memory).Path)
+	})
+
+	t.Run("Unknown store should return error", func(t *testing.T) {
+		t.Setenv("CONFIG_STORE", "mongo")
+
+		_, err := config.Open()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestHandlerWithMemory(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	config.NewHandler(config.NewMemory()).RegisterRoutes(e.Group("/admin"))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/deductions/personal", strings.NewReader(`{"amount": 70000}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var c config.Config
+	json.Unmarshal(rec.Body.Bytes(), &c)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 70000.0, c.PersonalDeduction)
+	assert.Equal(t, int64(2), c.Version)
+}
+
+func TestScheduleShouldCheckLaterChanges(t *testing.T) {
+	e := echo.New()
+	e.Validator = helper.NewValidator()
+	e.HTTPErrorHandler = helper.ErrorHandler
+	config.NewHandler(config.NewMemory()).RegisterRoutes(e.Group("/admin"))
+
+	schedule := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/config/schedule", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	later := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	sooner := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+
+	rec := schedule(`{"changes": {"personalDeduction": 90000}, "effectiveFrom": "` + later + `"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = schedule(`{"changes": {"limits": {"personalDeduction": {"min": 10000, "max": 80000}}}, "effectiveFrom": "` + sooner + `"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Scheduled change 1 would no longer be valid, cancel it first")
+}
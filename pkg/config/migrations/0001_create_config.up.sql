@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS config (
+  personal_deduction DECIMAL,
+  max_k_receipt DECIMAL
+);
+
+INSERT INTO config (personal_deduction, max_k_receipt)
+SELECT 60000, 50000
+WHERE NOT EXISTS (SELECT 1 FROM config);
@@ -0,0 +1,5 @@
+ALTER TABLE config
+  DROP COLUMN tax_brackets,
+  DROP COLUMN version;
+
+DROP TABLE config_versions;
@@ -0,0 +1,27 @@
+ALTER TABLE config
+  ADD COLUMN tax_brackets JSONB,
+  ADD COLUMN version BIGINT;
+
+CREATE TABLE config_versions (
+  id BIGSERIAL PRIMARY KEY,
+  config JSONB NOT NULL,
+  effective_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+WITH v AS (
+  INSERT INTO config_versions (config, effective_at)
+  SELECT jsonb_build_object(
+    'personalDeduction', personal_deduction,
+    'kReceipt', max_k_receipt,
+    'taxBrackets', '[
+      {"level": "0-150,000", "min": 0, "max": 150000, "rate": 0},
+      {"level": "150,001-500,000", "min": 150000, "max": 500000, "rate": 0.10},
+      {"level": "500,001-1,000,000", "min": 500000, "max": 1000000, "rate": 0.15},
+      {"level": "1,000,001-2,000,000", "min": 1000000, "max": 2000000, "rate": 0.20},
+      {"level": "2,000,001 ขึ้นไป", "min": 2000000, "rate": 0.35}
+    ]'::JSONB
+  ), '2024-01-01T00:00:00+07:00'
+  FROM config
+  RETURNING id, config
+)
+UPDATE config SET tax_brackets = v.config->'taxBrackets', version = v.id FROM v;
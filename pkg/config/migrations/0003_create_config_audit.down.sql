@@ -0,0 +1,2 @@
+DROP TABLE config_audit;
+DROP FUNCTION config_audit_append_only();
@@ -0,0 +1,22 @@
+CREATE TABLE config_audit (
+  id BIGSERIAL PRIMARY KEY,
+  username TEXT NOT NULL,
+  field TEXT NOT NULL,
+  old_value JSONB,
+  new_value JSONB,
+  version BIGINT NOT NULL REFERENCES config_versions (id),
+  request_id TEXT NOT NULL DEFAULT '',
+  changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX config_audit_field_changed_at_idx ON config_audit (field, changed_at DESC);
+
+CREATE FUNCTION config_audit_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'config_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER config_audit_append_only
+  BEFORE UPDATE OR DELETE ON config_audit
+  FOR EACH ROW EXECUTE FUNCTION config_audit_append_only();
@@ -0,0 +1,10 @@
+CREATE TABLE calculations (
+  id TEXT PRIMARY KEY,
+  type TEXT NOT NULL,
+  input JSONB NOT NULL,
+  config JSONB NOT NULL,
+  result JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX calculations_created_at_idx ON calculations (created_at DESC);
@@ -0,0 +1,14 @@
+CREATE TABLE config_schedule (
+  id BIGSERIAL PRIMARY KEY,
+  changes JSONB NOT NULL,
+  effective_from TIMESTAMPTZ NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  username TEXT NOT NULL,
+  request_id TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  applied_version BIGINT REFERENCES config_versions (id),
+  cancelled_by TEXT,
+  cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX config_schedule_status_effective_from_idx ON config_schedule (status, effective_from);
@@ -0,0 +1,7 @@
+ALTER TABLE config ADD COLUMN limits JSONB;
+
+UPDATE config SET limits = '{
+  "maxDonation": 100000,
+  "personalDeduction": {"min": 10000, "max": 100000},
+  "kReceipt": {"min": 0, "max": 100000}
+}';
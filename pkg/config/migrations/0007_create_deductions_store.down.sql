@@ -0,0 +1,9 @@
+ALTER TABLE config
+  ADD COLUMN personal_deduction DECIMAL,
+  ADD COLUMN max_k_receipt DECIMAL;
+
+UPDATE config SET
+  personal_deduction = (deductions->>'personal')::DECIMAL,
+  max_k_receipt = (deductions->>'k-receipt')::DECIMAL;
+
+ALTER TABLE config DROP COLUMN deductions;
@@ -0,0 +1,11 @@
+ALTER TABLE config ADD COLUMN deductions JSONB;
+
+UPDATE config SET deductions = jsonb_build_object(
+  'personal', personal_deduction,
+  'k-receipt', max_k_receipt,
+  'donation', limits->'maxDonation'
+);
+
+ALTER TABLE config
+  DROP COLUMN personal_deduction,
+  DROP COLUMN max_k_receipt;
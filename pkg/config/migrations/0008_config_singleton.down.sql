@@ -0,0 +1,13 @@
+ALTER TABLE config
+  DROP CONSTRAINT config_donation_check,
+  DROP CONSTRAINT config_k_receipt_check,
+  DROP CONSTRAINT config_personal_deduction_check,
+  DROP CONSTRAINT config_limits_check,
+  DROP CONSTRAINT config_tax_brackets_check,
+  DROP CONSTRAINT config_deductions_check,
+  DROP CONSTRAINT config_version_fkey,
+  ALTER COLUMN version DROP NOT NULL,
+  ALTER COLUMN limits DROP NOT NULL,
+  ALTER COLUMN tax_brackets DROP NOT NULL,
+  ALTER COLUMN deductions DROP NOT NULL,
+  DROP COLUMN id;
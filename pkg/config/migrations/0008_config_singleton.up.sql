@@ -0,0 +1,33 @@
+-- Keep only the current row; updates used to apply to every row.
+DELETE FROM config WHERE ctid NOT IN (
+  SELECT ctid FROM config ORDER BY version DESC NULLS LAST LIMIT 1
+);
+
+ALTER TABLE config
+  ADD COLUMN id BOOLEAN NOT NULL DEFAULT TRUE,
+  ADD CONSTRAINT config_pkey PRIMARY KEY (id),
+  ADD CONSTRAINT config_singleton CHECK (id),
+  ALTER COLUMN deductions SET NOT NULL,
+  ALTER COLUMN tax_brackets SET NOT NULL,
+  ALTER COLUMN limits SET NOT NULL,
+  ALTER COLUMN version SET NOT NULL,
+  ADD CONSTRAINT config_version_fkey FOREIGN KEY (version) REFERENCES config_versions (id),
+  ADD CONSTRAINT config_deductions_check CHECK (
+    jsonb_typeof(deductions) = 'object'
+    AND deductions ?& ARRAY['personal', 'k-receipt', 'donation']
+  ),
+  ADD CONSTRAINT config_tax_brackets_check CHECK (jsonb_typeof(tax_brackets) = 'array'),
+  ADD CONSTRAINT config_limits_check CHECK (
+    (limits->>'maxDonation')::NUMERIC >= 0
+    AND (limits->'personalDeduction'->>'min')::NUMERIC >= 0
+    AND (limits->'personalDeduction'->>'max')::NUMERIC >= (limits->'personalDeduction'->>'min')::NUMERIC
+    AND (limits->'kReceipt'->>'min')::NUMERIC >= 0
+    AND (limits->'kReceipt'->>'max')::NUMERIC >= (limits->'kReceipt'->>'min')::NUMERIC
+  ),
+  ADD CONSTRAINT config_personal_deduction_check CHECK (
+    (deductions->>'personal')::NUMERIC BETWEEN (limits->'personalDeduction'->>'min')::NUMERIC AND (limits->'personalDeduction'->>'max')::NUMERIC
+  ),
+  ADD CONSTRAINT config_k_receipt_check CHECK (
+    (deductions->>'k-receipt')::NUMERIC BETWEEN (limits->'kReceipt'->>'min')::NUMERIC AND (limits->'kReceipt'->>'max')::NUMERIC
+  ),
+  ADD CONSTRAINT config_donation_check CHECK ((deductions->>'donation')::NUMERIC >= 0);
@@ -0,0 +1,3 @@
+DROP TRIGGER config_schedule_notify ON config_schedule;
+DROP TRIGGER config_notify ON config;
+DROP FUNCTION notify_config_changed();
@@ -0,0 +1,15 @@
+-- API instances cache the config and drop the cache when notified.
+CREATE FUNCTION notify_config_changed() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('config_changed', TG_TABLE_NAME);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER config_notify
+  AFTER INSERT OR UPDATE OR DELETE ON config
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_config_changed();
+
+CREATE TRIGGER config_schedule_notify
+  AFTER INSERT OR UPDATE OR DELETE ON config_schedule
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_config_changed();
@@ -0,0 +1,7 @@
+CREATE TABLE admin_users (
+  id SERIAL PRIMARY KEY,
+  username TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  rate_limit INTEGER NOT NULL CHECK (rate_limit > 0),
+  daily_rows INTEGER NOT NULL CHECK (daily_rows >= 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+DROP TABLE auth_audit;
+DROP FUNCTION auth_audit_append_only();
@@ -0,0 +1,22 @@
+CREATE TABLE auth_audit (
+  id BIGSERIAL PRIMARY KEY,
+  event TEXT NOT NULL CHECK (event IN ('auth_failed', 'auth_locked_out')),
+  username TEXT NOT NULL,
+  remote_ip TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  locked_for_ms BIGINT NOT NULL DEFAULT 0,
+  request_id TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_audit_username_created_at_idx ON auth_audit (username, created_at DESC);
+
+CREATE FUNCTION auth_audit_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'auth_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_audit_append_only
+  BEFORE UPDATE OR DELETE ON auth_audit
+  FOR EACH ROW EXECUTE FUNCTION auth_audit_append_only();
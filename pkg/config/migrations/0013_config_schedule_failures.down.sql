@@ -0,0 +1,2 @@
+UPDATE config_schedule SET status = 'cancelled' WHERE status = 'failed';
+ALTER TABLE config_schedule DROP COLUMN failure;
@@ -0,0 +1 @@
+ALTER TABLE config_schedule ADD COLUMN failure TEXT;
@@ -0,0 +1,33 @@
+package config
+
+import "encoding/json"
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to the target document.
+// Objects are merged recursively, null removes a member and any other value,
+// including arrays, replaces the target.
+func mergePatch(target json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &p); err != nil || p == nil {
+		return patch, nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(target, &doc); err != nil || doc == nil {
+		doc = map[string]json.RawMessage{}
+	}
+
+	for name, value := range p {
+		if string(value) == "null" {
+			delete(doc, name)
+			continue
+		}
+
+		merged, err := mergePatch(doc[name], value)
+		if err != nil {
+			return nil, err
+		}
+		doc[name] = merged
+	}
+
+	return json.Marshal(doc)
+}
@@ -1,27 +1,239 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"strconv"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/migrate"
+	"github.com/lib/pq"
 )
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 type Postgres struct {
 	Db *sql.DB
+	// Timeout bounds every method call, including all the queries of a
+	// transaction. Zero means no timeout other than the caller's.
+	Timeout time.Duration
+}
+
+const DEFAULT_QUERY_TIMEOUT = 5 * time.Second
+
+// Open picks the store from CONFIG_STORE: postgres, the default, or memory.
+// The memory store is backed by CONFIG_FILE when it is set.
+func Open() (Database, error) {
+	switch store := os.Getenv("CONFIG_STORE"); store {
+	case "", "postgres":
+		p, err := New()
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "memory":
+		if path := os.Getenv("CONFIG_FILE"); path != "" {
+			return NewFileMemory(path)
+		}
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("err: unknown CONFIG_STORE %q", store)
+	}
 }
 
+// New connects to DATABASE_URL and applies pending migrations, unless
+// AUTO_MIGRATE is false and they are applied with the migrate subcommand.
 func New() (*Postgres, error) {
+	db, err := Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		m, err := NewMigrator(db)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := m.Up(); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := DEFAULT_QUERY_TIMEOUT
+	if v := os.Getenv("DB_QUERY_TIMEOUT"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("err: invalid DB_QUERY_TIMEOUT: %w", err)
+		}
+	}
+
+	return &Postgres{Db: db, Timeout: timeout}, nil
+}
+
+// withTimeout applies the timeout to ctx. The returned func must be deferred
+// with the error the method returns: drivers report cancelled queries in
+// their own way, so errors after ctx is done are wrapped with ctx.Err() for
+// callers to check with errors.Is.
+func (p *Postgres) withTimeout(ctx context.Context) (context.Context, func(*error)) {
+	cancel := func() {}
+	if p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil && !errors.Is(*err, ctx.Err()) {
+			*err = fmt.Errorf("%w: %v", ctx.Err(), *err)
+		}
+		cancel()
+	}
+}
+
+// PoolConfig holds the connection pool settings and how long to wait for the
+// database at startup.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		ConnectAttempts: 5,
+		ConnectBackoff:  time.Second,
+	}
+}
+
+const MAX_CONNECT_BACKOFF = 30 * time.Second
+
+// PoolConfigFromEnv reads the DB_* variables, keeping the defaults of those
+// not set.
+func PoolConfigFromEnv() (PoolConfig, error) {
+	pc := DefaultPoolConfig()
+
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS":   &pc.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":   &pc.MaxIdleConns,
+		"DB_CONNECT_ATTEMPTS": &pc.ConnectAttempts,
+	}
+	for key, dest := range ints {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return PoolConfig{}, fmt.Errorf("err: invalid %s: %w", key, err)
+			}
+			*dest = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":  &pc.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": &pc.ConnMaxIdleTime,
+		"DB_CONNECT_BACKOFF":    &pc.ConnectBackoff,
+	}
+	for key, dest := range durations {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return PoolConfig{}, fmt.Errorf("err: invalid %s: %w", key, err)
+			}
+			*dest = d
+		}
+	}
+
+	return pc, nil
+}
+
+func (pc PoolConfig) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(pc.MaxOpenConns)
+	db.SetMaxIdleConns(pc.MaxIdleConns)
+	db.SetConnMaxLifetime(pc.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pc.ConnMaxIdleTime)
+}
+
+// Connect opens DATABASE_URL with the pool settings from the environment and
+// waits for the database to answer, so the service can start before it.
+func Connect() (*sql.DB, error) {
 	var DATABASE_URL = os.Getenv("DATABASE_URL")
 
+	pc, err := PoolConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open("postgres", DATABASE_URL)
 	if err != nil {
 		return nil, err
 	}
-	err = db.Ping()
+	pc.Apply(db)
+
+	err = helper.Retry(pc.ConnectAttempts, pc.ConnectBackoff, MAX_CONNECT_BACKOFF, db.Ping)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
 	if err != nil {
 		return nil, err
 	}
+	return migrate.New(db, fsys)
+}
 
-	return &Postgres{Db: db}, nil
+// Migrated returns an error unless every migration has been applied.
+func (p *Postgres) Migrated(ctx context.Context) error {
+	m, err := NewMigrator(p.Db)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("err: %d migrations pending", len(pending))
+	}
+	return nil
+}
+
+const CHANGE_CHANNEL = "config_changed"
+
+// Listen calls onChange whenever the config or its scheduled changes are
+// written, by any instance, until ctx is done. Notifications sent while the
+// connection was lost cannot be recovered, so onChange is also called after
+// every reconnect.
+func Listen(ctx context.Context, onChange func()) error {
+	l := pq.NewListener(os.Getenv("DATABASE_URL"), time.Second, time.Minute, nil)
+	defer l.Close()
+
+	if err := l.Listen(CHANGE_CHANNEL); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-l.Notify:
+			// nil after a reconnect
+			onChange()
+		case <-time.After(90 * time.Second):
+			go l.Ping()
+		}
+	}
 }
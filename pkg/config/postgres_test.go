@@ -0,0 +1,58 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	m, err := config.NewMigrator(nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), m.Migrations[0].Version)
+	assert.Equal(t, "create_config", m.Migrations[0].Name)
+	for i, mig := range m.Migrations {
+		assert.Equal(t, int64(i+1), mig.Version, "migrations should be numbered without gaps")
+	}
+}
+
+func TestPoolConfigFromEnv(t *testing.T) {
+	t.Run("Unset variables should keep defaults", func(t *testing.T) {
+		pc, err := config.PoolConfigFromEnv()
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.DefaultPoolConfig(), pc)
+	})
+
+	t.Run("Variables should override defaults", func(t *testing.T) {
+		t.Setenv("DB_MAX_OPEN_CONNS", "50")
+		t.Setenv("DB_MAX_IDLE_CONNS", "10")
+		t.Setenv("DB_CONN_MAX_LIFETIME", "1h")
+		t.Setenv("DB_CONN_MAX_IDLE_TIME", "1m")
+		t.Setenv("DB_CONNECT_ATTEMPTS", "10")
+		t.Setenv("DB_CONNECT_BACKOFF", "500ms")
+
+		pc, err := config.PoolConfigFromEnv()
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.PoolConfig{
+			MaxOpenConns:    50,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: time.Minute,
+			ConnectAttempts: 10,
+			ConnectBackoff:  500 * time.Millisecond,
+		}, pc)
+	})
+
+	t.Run("Invalid value should return error", func(t *testing.T) {
+		t.Setenv("DB_CONN_MAX_LIFETIME", "forever")
+
+		_, err := config.PoolConfigFromEnv()
+
+		assert.Error(t, err)
+	})
+}
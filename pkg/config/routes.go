@@ -4,6 +4,16 @@ import "github.com/labstack/echo/v4"
 
 func (h Handler) RegisterRoutes(e *echo.Group) {
 	e.GET("/config", h.GetConfigHandler)
-	e.POST("/deductions/personal", h.SetPersonalDeductionHandler)
-	e.POST("/deductions/k-receipt", h.SetMaxKReceiptHandler)
+	e.PUT("/config", h.ReplaceConfigHandler)
+	e.PATCH("/config", h.PatchConfigHandler)
+	e.GET("/config/versions", h.ListConfigVersionsHandler)
+	e.GET("/config/versions/:version", h.GetConfigVersionHandler)
+	e.GET("/config/schedule", h.ListScheduledChangesHandler)
+	e.POST("/config/schedule", h.ScheduleChangeHandler)
+	e.DELETE("/config/schedule/:id", h.CancelScheduledChangeHandler)
+	e.GET("/deductions", h.ListDeductionsHandler)
+	e.POST("/deductions/:type", h.SetDeductionHandler)
+	e.GET("/limits", h.GetLimitsHandler)
+	e.PUT("/limits", h.SetLimitsHandler)
+	e.GET("/audit", h.ListAuditHandler)
 }
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var ScheduleStatus = struct {
+	Pending   string
+	Applied   string
+	Cancelled string
+	Failed    string
+}{
+	Pending:   "pending",
+	Applied:   "applied",
+	Cancelled: "cancelled",
+	Failed:    "failed",
+}
+
+var (
+	ErrScheduledChangeNotFound   = errors.New("scheduled change not found")
+	ErrScheduledChangeNotPending = errors.New("scheduled change is not pending")
+	ErrNoConfigAt                = errors.New("no config effective at the given date")
+)
+
+// ScheduledChange is a partial config, in the same JSON shape as Config, that
+// takes effect at EffectiveFrom.
+type ScheduledChange struct {
+	ID             int64           `json:"id"`
+	Changes        json.RawMessage `json:"changes"`
+	EffectiveFrom  time.Time       `json:"effectiveFrom"`
+	Status         string          `json:"status"`
+	Username       string          `json:"username"`
+	RequestID      string          `json:"requestId,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	AppliedVersion int64           `json:"appliedVersion,omitempty"`
+	CancelledBy    string          `json:"cancelledBy,omitempty"`
+	CancelledAt    *time.Time      `json:"cancelledAt,omitempty"`
+	// Failure is why the change could not be applied when it was due.
+	Failure string `json:"failure,omitempty"`
+}
+
+// Apply returns a copy of the config with the changes, a JSON Merge Patch of
+// the config document, applied. Fields set to null are reset, and unknown
+// fields are rejected.
+func (c Config) Apply(changes json.RawMessage) (Config, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(changes, &patch); err != nil || patch == nil {
+		return Config{}, errors.New("err: changes must be a JSON object")
+	}
+	if len(patch) == 0 {
+		return Config{}, errors.New("err: no changes")
+	}
+	if _, ok := patch["version"]; ok {
+		return Config{}, errors.New("err: version cannot be changed")
+	}
+
+	doc, err := json.Marshal(c.withDefaults())
+	if err != nil {
+		return Config{}, err
+	}
+
+	b, err := mergePatch(doc, changes)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var next Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		return Config{}, fmt.Errorf("err: invalid changes: %w", err)
+	}
+	// null resets the brackets to the defaults, but an empty list is a
+	// mistake withDefaults would hide the same way.
+	if next.TaxBrackets != nil && len(next.TaxBrackets) == 0 {
+		return Config{}, errors.New("err: taxBrackets must not be empty")
+	}
+	return next.withDefaults(), nil
+}
+
+// applyScheduled applies the scheduled change and checks the result, since
+// the config may have changed since the change was scheduled.
+func (c Config) applyScheduled(sc ScheduledChange) (Config, error) {
+	next, err := c.Apply(sc.Changes)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := next.Validate(); err != nil {
+		return Config{}, err
+	}
+	return next, nil
+}
+
+// checkPending returns an error when one of the pending changes, applied in
+// order, would leave c invalid, so a write cannot strand a change that is
+// already scheduled.
+func checkPending(c Config, pending []ScheduledChange) error {
+	for _, sc := range pending {
+		next, err := c.applyScheduled(sc)
+		if err != nil {
+			return InvalidConfigError{configErrorf("Scheduled change %d would no longer be valid, cancel it first", sc.ID)}
+		}
+		c = next
+	}
+	return nil
+}
+
+const scheduleColumns = "id, changes, effective_from, status, username, request_id, created_at, applied_version, cancelled_by, cancelled_at, failure"
+
+func scanScheduledChange(row scanner) (sc ScheduledChange, err error) {
+	var changes []byte
+	var applied sql.NullInt64
+	var cancelledBy sql.NullString
+	var cancelledAt sql.NullTime
+	var failure sql.NullString
+	err = row.Scan(&sc.ID, &changes, &sc.EffectiveFrom, &sc.Status, &sc.Username, &sc.RequestID, &sc.CreatedAt, &applied, &cancelledBy, &cancelledAt, &failure)
+	if err != nil {
+		return ScheduledChange{}, err
+	}
+	sc.Changes = changes
+	sc.AppliedVersion = applied.Int64
+	sc.CancelledBy = cancelledBy.String
+	if cancelledAt.Valid {
+		sc.CancelledAt = &cancelledAt.Time
+	}
+	sc.Failure = failure.String
+
+	return sc, nil
+}
+
+func queryScheduledChanges(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) ([]ScheduledChange, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []ScheduledChange{}
+	for rows.Next() {
+		sc, err := scanScheduledChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// applyDueChanges turns every pending change that has taken effect into a
+// version effective at its EffectiveFrom, oldest first. A change that would
+// leave the config invalid is marked failed and skipped, so it cannot block
+// later changes and writes.
+func applyDueChanges(ctx context.Context, tx *sql.Tx, c Config) (Config, error) {
+	due, err := queryScheduledChanges(ctx, tx,
+		"SELECT "+scheduleColumns+" FROM config_schedule WHERE status = $1 AND effective_from <= now() ORDER BY effective_from, id FOR UPDATE",
+		ScheduleStatus.Pending,
+	)
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, sc := range due {
+		next, err := c.applyScheduled(sc)
+		if err != nil {
+			slog.Warn("scheduled config change failed", slog.Int64("id", sc.ID), slog.Any("error", err))
+			_, err = tx.ExecContext(ctx, "UPDATE config_schedule SET status = $1, failure = $2 WHERE id = $3", ScheduleStatus.Failed, err.Error(), sc.ID)
+			if err != nil {
+				return Config{}, err
+			}
+			continue
+		}
+
+		effectiveFrom := sc.EffectiveFrom
+		c, err = saveVersion(ctx, tx, c, next, Actor{Username: sc.Username, RequestID: sc.RequestID}, &effectiveFrom)
+		if err != nil {
+			return Config{}, err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE config_schedule SET status = $1, applied_version = $2 WHERE id = $3", ScheduleStatus.Applied, c.Version, sc.ID)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	return c, nil
+}
+
+// ApplyScheduledChanges gives every scheduled change that has taken effect
+// its own version, so calculations made with it can be reproduced. It runs
+// from RunSchedule rather than on reads.
+func (p *Postgres) ApplyScheduledChanges(ctx context.Context) (Config, error) {
+	return p.update(ctx, Actor{}, nil)
+}
+
+// RunSchedule applies due scheduled changes every interval until ctx is done.
+// Instances running it at the same time are serialized by the row lock on
+// the config, so each change is applied once.
+func RunSchedule(ctx context.Context, db Database, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := db.ApplyScheduledChanges(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("failed to apply scheduled config changes", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetConfigAt resolves the config effective at t. Past dates use the version
+// that was effective then; future dates apply the pending changes due by then
+// to the current config and keep its version.
+func (p *Postgres) GetConfigAt(ctx context.Context, t time.Time) (_ Config, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	c, err := p.GetConfig(ctx)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if t.After(time.Now()) {
+		return projectConfig(ctx, c, p.ListScheduledChanges, t)
+	}
+
+	v, err := scanConfigVersion(p.Db.QueryRowContext(ctx,
+		"SELECT id, config, effective_at FROM config_versions WHERE effective_at <= $1 ORDER BY effective_at DESC, id DESC LIMIT 1", t,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Config{}, ErrNoConfigAt
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	return v.Config, nil
+}
+
+// projectConfig applies the pending changes due by t to c. The result keeps
+// the version of c, the one it was projected from.
+func projectConfig(ctx context.Context, c Config, list func(context.Context, string) ([]ScheduledChange, error), t time.Time) (Config, error) {
+	pending, err := list(ctx, ScheduleStatus.Pending)
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, sc := range pending {
+		if sc.EffectiveFrom.After(t) {
+			break
+		}
+		// Invalid changes are skipped, as they will fail when applied.
+		next, err := c.applyScheduled(sc)
+		if err != nil {
+			continue
+		}
+		c = next
+	}
+
+	return c, nil
+}
+
+func (p *Postgres) ScheduleChange(ctx context.Context, sc ScheduledChange, a Actor) (_ ScheduledChange, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	return scanScheduledChange(p.Db.QueryRowContext(ctx,
+		"INSERT INTO config_schedule (changes, effective_from, username, request_id) VALUES ($1, $2, $3, $4) RETURNING "+scheduleColumns,
+		[]byte(sc.Changes), sc.EffectiveFrom, a.Username, a.RequestID,
+	))
+}
+
+// ListScheduledChanges lists changes in the order they take effect. An empty
+// status lists changes of every status.
+func (p *Postgres) ListScheduledChanges(ctx context.Context, status string) (_ []ScheduledChange, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	if status == "" {
+		return queryScheduledChanges(ctx, p.Db, "SELECT "+scheduleColumns+" FROM config_schedule ORDER BY effective_from, id")
+	}
+	return queryScheduledChanges(ctx, p.Db, "SELECT "+scheduleColumns+" FROM config_schedule WHERE status = $1 ORDER BY effective_from, id", status)
+}
+
+// CancelScheduledChange cancels a pending change, including one that is due
+// but not applied yet. The row lock taken by applyDueChanges keeps the two
+// from both succeeding.
+func (p *Postgres) CancelScheduledChange(ctx context.Context, id int64, a Actor) (_ ScheduledChange, err error) {
+	ctx, done := p.withTimeout(ctx)
+	defer done(&err)
+
+	sc, err := scanScheduledChange(p.Db.QueryRowContext(ctx,
+		"UPDATE config_schedule SET status = $1, cancelled_by = $2, cancelled_at = now() WHERE id = $3 AND status = $4 RETURNING "+scheduleColumns,
+		ScheduleStatus.Cancelled, a.Username, id, ScheduleStatus.Pending,
+	))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return sc, err
+	}
+
+	var exists bool
+	if err := p.Db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM config_schedule WHERE id = $1)", id).Scan(&exists); err != nil {
+		return ScheduledChange{}, err
+	}
+	if !exists {
+		return ScheduledChange{}, ErrScheduledChangeNotFound
+	}
+	return ScheduledChange{}, ErrScheduledChangeNotPending
+}
@@ -0,0 +1,474 @@
+package config_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	current := config.Config{
+		PersonalDeduction: 60000,
+		MaxKReceipt:       50000,
+		TaxBrackets:       config.DefaultTaxBrackets(),
+		Version:           3,
+	}
+
+	t.Run("Given changed fields should return updated copy", func(t *testing.T) {
+		next, err := current.Apply(json.RawMessage(`{"personalDeduction": 70000}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, next.PersonalDeduction)
+		assert.Equal(t, 50000.0, next.MaxKReceipt)
+		assert.Equal(t, 60000.0, current.PersonalDeduction)
+	})
+
+	t.Run("Given null should reset the field", func(t *testing.T) {
+		next, err := current.Apply(json.RawMessage(`{"kReceipt": null, "taxBrackets": null}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0.0, next.MaxKReceipt)
+		assert.Equal(t, config.DefaultTaxBrackets(), next.TaxBrackets)
+	})
+
+	t.Run("Given array should replace it", func(t *testing.T) {
+		next, err := current.Apply(json.RawMessage(`{"taxBrackets": [{"level": "flat", "min": 0, "rate": 0.1}]}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []config.TaxBracket{{Level: "flat", Min: 0, Rate: 0.1}}, next.TaxBrackets)
+		assert.Len(t, current.TaxBrackets, 5)
+	})
+
+	invalid := map[string]string{
+		"Unknown field":   `{"unknown": 1}`,
+		"Version":         `{"version": 10}`,
+		"Empty changes":   `{}`,
+		"Not an object":   `[1, 2]`,
+		"Null changes":    `null`,
+		"Wrong data type": `{"personalDeduction": "70000"}`,
+	}
+	for name, changes := range invalid {
+		t.Run(name+" should return error", func(t *testing.T) {
+			_, err := current.Apply(json.RawMessage(changes))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := config.Config{
+		PersonalDeduction: config.DEFAULT_PERSONAL_DEDUCTION,
+		MaxKReceipt:       config.DEFAULT_MAX_K_RECEIPT,
+		TaxBrackets:       config.DefaultTaxBrackets(),
+	}
+
+	t.Run("Default config should be valid", func(t *testing.T) {
+		assert.NoError(t, valid.Validate())
+	})
+
+	t.Run("Config within custom limits should be valid", func(t *testing.T) {
+		c := valid
+		l := config.DefaultLimits()
+		l.PersonalDeduction = config.Range{Min: 150000, Max: 200000}
+		c.DeductionLimits = &l
+		c.PersonalDeduction = 150000
+
+		assert.NoError(t, c.Validate())
+	})
+
+	cases := map[string]func(c *config.Config){
+		"Personal deduction below minimum": func(c *config.Config) { c.PersonalDeduction = config.MIN_PERSONAL_DEDUCTION - 1 },
+		"Personal deduction above maximum": func(c *config.Config) { c.PersonalDeduction = config.MAX_PERSONAL_DEDUCTION + 1 },
+		"K-Receipt above maximum":          func(c *config.Config) { c.MaxKReceipt = config.MAX_K_RECEIPT + 1 },
+		"K-Receipt below minimum":          func(c *config.Config) { c.MaxKReceipt = -1 },
+		"Bracket not starting at 0":        func(c *config.Config) { c.TaxBrackets[0].Min = 1 },
+		"Gap between brackets":             func(c *config.Config) { c.TaxBrackets[1].Min = 160000 },
+		"Bracket rate above 1":             func(c *config.Config) { c.TaxBrackets[2].Rate = 1.5 },
+		"Bounded last bracket":             func(c *config.Config) { c.TaxBrackets[4].Max = 5000000 },
+		"Unbounded middle bracket": func(c *config.Config) {
+			c.TaxBrackets = []config.TaxBracket{{Level: "a", Min: 0}, {Level: "b", Min: 0}}
+		},
+		"Personal deduction above custom maximum": func(c *config.Config) {
+			l := config.DefaultLimits()
+			l.PersonalDeduction.Max = 50000
+			c.DeductionLimits = &l
+		},
+		"Negative donation maximum": func(c *config.Config) {
+			l := config.DefaultLimits()
+			l.MaxDonation = -1
+			c.DeductionLimits = &l
+		},
+		"Limit maximum below minimum": func(c *config.Config) {
+			l := config.DefaultLimits()
+			l.KReceipt = config.Range{Min: 1000, Max: 500}
+			c.DeductionLimits = &l
+		},
+	}
+	for name, change := range cases {
+		t.Run(name+" should return error", func(t *testing.T) {
+			c := valid
+			c.TaxBrackets = config.DefaultTaxBrackets()
+			change(&c)
+
+			assert.Error(t, c.Validate())
+		})
+	}
+}
+
+func TestGetConfigReadsDueChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	effectiveFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(60000, 50000), nil, nil, 1, true))
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status").
+		WithArgs(config.ScheduleStatus.Pending).
+		WillReturnRows(scheduleRows().AddRow(4, []byte(`{"personalDeduction":70000}`), effectiveFrom, "pending", "adminTax", "req-1", effectiveFrom.Add(-time.Hour), nil, nil, nil, nil))
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	cfg, err := p.GetConfig(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 70000.0, cfg.PersonalDeduction)
+	assert.Equal(t, int64(0), cfg.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyScheduledChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	effectiveFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 1))
+	mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) FOR UPDATE").
+		WithArgs(config.ScheduleStatus.Pending).
+		WillReturnRows(scheduleRows().AddRow(4, []byte(`{"personalDeduction":70000}`), effectiveFrom, "pending", "adminTax", "req-1", effectiveFrom.Add(-time.Hour), nil, nil, nil, nil))
+	mock.ExpectQuery("INSERT INTO config_versions").
+		WithArgs(sqlmock.AnyArg(), &effectiveFrom).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(`INSERT INTO config \(id`).WithArgs(deductions(70000, 50000), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO config_audit").
+		WithArgs("adminTax", "personalDeduction", []byte("60000"), []byte("70000"), int64(2), "req-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE config_schedule SET status").
+		WithArgs(config.ScheduleStatus.Applied, int64(2), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	cfg, err := p.ApplyScheduledChanges(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 70000.0, cfg.PersonalDeduction)
+	assert.Equal(t, int64(2), cfg.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyScheduledChangeOutOfLimits(t *testing.T) {
+	effectiveFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := []byte(`{"maxDonation":100000,"personalDeduction":{"min":10000,"max":80000},"kReceipt":{"min":0,"max":100000}}`)
+
+	t.Run("Due change should be marked failed and skipped", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, limits, 2))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) FOR UPDATE").
+			WithArgs(config.ScheduleStatus.Pending).
+			WillReturnRows(scheduleRows().AddRow(4, []byte(`{"personalDeduction":90000}`), effectiveFrom, "pending", "adminTax", "req-1", effectiveFrom.Add(-time.Hour), nil, nil, nil, nil))
+		mock.ExpectExec("UPDATE config_schedule SET status").
+			WithArgs(config.ScheduleStatus.Failed, "Personal deduction must be between 10000 and 80000", int64(4)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.ApplyScheduledChanges(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 60000.0, cfg.PersonalDeduction)
+		assert.Equal(t, int64(2), cfg.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lowering the limits below a pending change should fail", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT (.+) FROM config WHERE id FOR UPDATE").WillReturnRows(configRows().AddRow(deductions(60000, 50000), nil, nil, 2))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) FOR UPDATE").WillReturnRows(scheduleRows())
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id$").
+			WithArgs(config.ScheduleStatus.Pending).
+			WillReturnRows(scheduleRows().AddRow(4, []byte(`{"personalDeduction":90000}`), effectiveFrom, "pending", "adminTax", "req-1", effectiveFrom.Add(-time.Hour), nil, nil, nil, nil))
+		mock.ExpectRollback()
+
+		p := &config.Postgres{
+			Db: db,
+		}
+		lower := config.DefaultLimits()
+		lower.PersonalDeduction.Max = 80000
+
+		_, err = p.SetLimits(context.Background(), lower, config.Actor{})
+
+		var invalid config.InvalidConfigError
+		assert.ErrorAs(t, err, &invalid)
+		assert.EqualError(t, err, "Scheduled change 4 would no longer be valid, cancel it first")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetConfigAt(t *testing.T) {
+	effectiveAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Past date should return version effective then", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		date := effectiveAt.Add(24 * time.Hour)
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(70000, 50000), nil, nil, 2, false))
+		mock.ExpectQuery("SELECT (.+) FROM config_versions WHERE effective_at <= (.+) ORDER BY effective_at DESC").
+			WithArgs(date).
+			WillReturnRows(versionRows().AddRow(1, []byte(`{"personalDeduction":60000,"kReceipt":50000}`), effectiveAt))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.GetConfigAt(context.Background(), date)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 60000.0, cfg.PersonalDeduction)
+		assert.Equal(t, int64(1), cfg.Version)
+	})
+
+	t.Run("Date before the first version should return error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(70000, 50000), nil, nil, 2, false))
+		mock.ExpectQuery("SELECT (.+) FROM config_versions WHERE effective_at").WillReturnError(sql.ErrNoRows)
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.GetConfigAt(context.Background(), effectiveAt.AddDate(-10, 0, 0))
+
+		assert.ErrorIs(t, err, config.ErrNoConfigAt)
+	})
+
+	t.Run("Future date should apply pending changes due by then", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		soon := time.Now().Add(24 * time.Hour)
+		later := time.Now().Add(48 * time.Hour)
+		mock.ExpectQuery("SELECT (.+) FROM config").WillReturnRows(currentConfigRows().AddRow(deductions(60000, 50000), nil, nil, 2, false))
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status").
+			WithArgs(config.ScheduleStatus.Pending).
+			WillReturnRows(scheduleRows().
+				AddRow(1, []byte(`{"personalDeduction":70000}`), soon, "pending", "adminTax", "", soon, nil, nil, nil, nil).
+				AddRow(2, []byte(`{"kReceipt":60000}`), later, "pending", "adminTax", "", soon, nil, nil, nil, nil))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		cfg, err := p.GetConfigAt(context.Background(), soon.Add(time.Hour))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 70000.0, cfg.PersonalDeduction)
+		assert.Equal(t, 50000.0, cfg.MaxKReceipt)
+		assert.Equal(t, int64(2), cfg.Version)
+	})
+}
+
+func TestScheduleChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	effectiveFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("INSERT INTO config_schedule").
+		WithArgs([]byte(`{"kReceipt":70000}`), effectiveFrom, "adminTax", "req-1").
+		WillReturnRows(scheduleRows().AddRow(1, []byte(`{"kReceipt":70000}`), effectiveFrom, "pending", "adminTax", "req-1", effectiveFrom, nil, nil, nil, nil))
+
+	p := &config.Postgres{
+		Db: db,
+	}
+
+	sc, err := p.ScheduleChange(context.Background(),
+		config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: effectiveFrom},
+		config.Actor{Username: "adminTax", RequestID: "req-1"},
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), sc.ID)
+	assert.Equal(t, config.ScheduleStatus.Pending, sc.Status)
+	assert.Equal(t, "adminTax", sc.Username)
+}
+
+func TestListScheduledChanges(t *testing.T) {
+	t.Run("By status", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		now := time.Now()
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule WHERE status = (.+) ORDER BY effective_from, id").
+			WithArgs("applied").
+			WillReturnRows(scheduleRows().AddRow(1, []byte(`{"kReceipt":70000}`), now, "applied", "adminTax", "", now, 3, nil, nil, nil))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		changes, err := p.ListScheduledChanges(context.Background(), "applied")
+
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+		assert.Equal(t, int64(3), changes[0].AppliedVersion)
+	})
+
+	t.Run("All", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT (.+) FROM config_schedule ORDER BY effective_from, id").WillReturnRows(scheduleRows())
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		changes, err := p.ListScheduledChanges(context.Background(), "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []config.ScheduledChange{}, changes)
+	})
+}
+
+func TestCancelScheduledChange(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		now := time.Now()
+		mock.ExpectQuery("UPDATE config_schedule SET status").
+			WithArgs(config.ScheduleStatus.Cancelled, "editor", int64(1), config.ScheduleStatus.Pending).
+			WillReturnRows(scheduleRows().AddRow(1, []byte(`{"kReceipt":70000}`), now, "cancelled", "adminTax", "", now, nil, "editor", now, nil))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		sc, err := p.CancelScheduledChange(context.Background(), 1, config.Actor{Username: "editor"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, config.ScheduleStatus.Cancelled, sc.Status)
+		assert.Equal(t, "editor", sc.CancelledBy)
+		assert.NotNil(t, sc.CancelledAt)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("UPDATE config_schedule SET status").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.CancelScheduledChange(context.Background(), 1, config.Actor{Username: "adminTax"})
+
+		assert.ErrorIs(t, err, config.ErrScheduledChangeNotFound)
+	})
+
+	t.Run("Not pending", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("UPDATE config_schedule SET status").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		p := &config.Postgres{
+			Db: db,
+		}
+
+		_, err = p.CancelScheduledChange(context.Background(), 1, config.Actor{Username: "adminTax"})
+
+		assert.ErrorIs(t, err, config.ErrScheduledChangeNotPending)
+	})
+}
+
+func TestRunSchedule(t *testing.T) {
+	m := config.NewMemory()
+	m.ScheduleChange(context.Background(), config.ScheduledChange{Changes: json.RawMessage(`{"kReceipt":70000}`), EffectiveFrom: time.Now().Add(-time.Minute)}, config.Actor{Username: "adminTax"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go config.RunSchedule(ctx, m, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		applied, _ := m.ListScheduledChanges(context.Background(), config.ScheduleStatus.Applied)
+		return len(applied) == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+)
+
+const PING_TIMEOUT = 2 * time.Second
+
+var Status = struct {
+	Up       string
+	Down     string
+	Draining string
+}{
+	Up:       "up",
+	Down:     "down",
+	Draining: "draining",
+}
+
+// Check returns an error when a dependency the service needs is not usable.
+type Check func(context.Context) error
+
+type Handler struct {
+	// Db is nil when the config store is not Postgres.
+	Db *sql.DB
+	// Checks must all pass for the service to be ready, keyed by name.
+	Checks   map[string]Check
+	draining *atomic.Bool
+}
+
+func NewHandler(db *sql.DB) Handler {
+	h := Handler{Db: db, Checks: map[string]Check{}, draining: &atomic.Bool{}}
+	if db != nil {
+		h.Checks["database"] = db.PingContext
+	}
+	return h
+}
+
+// Drain makes the service report not ready from now on, so load balancers
+// stop sending requests before it shuts down.
+func (h Handler) Drain() {
+	h.draining.Store(true)
+}
+
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// LiveHandler reports that the process is running and serving requests.
+func (h Handler) LiveHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": Status.Up})
+}
+
+// ReadyHandler runs every check and reports 503 when any fails or the
+// service is shutting down. The endpoint is public, so failures are only
+// reported as down and their errors are logged.
+func (h Handler) ReadyHandler(c echo.Context) error {
+	if h.draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, Readiness{Status: Status.Draining})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), PING_TIMEOUT)
+	defer cancel()
+
+	res := Readiness{Status: Status.Up, Checks: map[string]string{}}
+	status := http.StatusOK
+	for name, check := range h.Checks {
+		if err := check(ctx); err != nil {
+			helper.Logger(c).Error("readiness check failed",
+				slog.String("check", name),
+				slog.String("error", err.Error()),
+			)
+			res.Checks[name] = Status.Down
+			res.Status = Status.Down
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		res.Checks[name] = Status.Up
+	}
+
+	return c.JSON(status, res)
+}
+
+// DBStats is sql.DBStats in the JSON shape of the API.
+type DBStats struct {
+	MaxOpenConnections int   `json:"maxOpenConnections"`
+	OpenConnections    int   `json:"openConnections"`
+	InUse              int   `json:"inUse"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"waitCount"`
+	WaitDurationMs     int64 `json:"waitDurationMs"`
+	MaxIdleClosed      int64 `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64 `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64 `json:"maxLifetimeClosed"`
+}
+
+type DBHealth struct {
+	Status string  `json:"status"`
+	Error  string  `json:"error,omitempty"`
+	Stats  DBStats `json:"stats"`
+}
+
+func NewDBStats(s sql.DBStats) DBStats {
+	return DBStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// DBHandler pings the database and reports the connection pool statistics
+// and the error, so it is only served to admins.
+func (h Handler) DBHandler(c echo.Context) error {
+	if h.Db == nil {
+		return helper.NotFound("no database configured", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), PING_TIMEOUT)
+	defer cancel()
+
+	res := DBHealth{Status: Status.Up}
+	status := http.StatusOK
+	if err := h.Db.PingContext(ctx); err != nil {
+		res.Status, res.Error = Status.Down, err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	res.Stats = NewDBStats(h.Db.Stats())
+
+	return c.JSON(status, res)
+}
@@ -0,0 +1,143 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/health"
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBHandler(t *testing.T) {
+	t.Run("Database up should return stats", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(10)
+		mock.ExpectPing()
+
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/health/db")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/health/db", nil), rec)
+
+		helper.ErrorHandler(health.NewHandler(db).DBHandler(c), c)
+
+		var body health.DBHealth
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, health.Status.Up, body.Status)
+		assert.Equal(t, 10, body.Stats.MaxOpenConnections)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Database down should return 503", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/health/db")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/health/db", nil), rec)
+
+		helper.ErrorHandler(health.NewHandler(db).DBHandler(c), c)
+
+		var body health.DBHealth
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, health.Status.Down, body.Status)
+		assert.Equal(t, "connection refused", body.Error)
+	})
+
+	t.Run("No database should return 404", func(t *testing.T) {
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/admin/health/db")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/health/db", nil), rec)
+
+		helper.ErrorHandler(health.NewHandler(nil).DBHandler(c), c)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestLiveHandler(t *testing.T) {
+	rec := openapitest.NewRecorder(t, http.MethodGet, "/healthz")
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)
+
+	helper.ErrorHandler(health.NewHandler(nil).LiveHandler(c), c)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReadyHandler(t *testing.T) {
+	t.Run("All checks passing should be ready", func(t *testing.T) {
+		h := health.NewHandler(nil)
+		h.Checks["config"] = func(context.Context) error { return nil }
+
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/readyz")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+		helper.ErrorHandler(h.ReadyHandler(c), c)
+
+		var body health.Readiness
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, map[string]string{"config": health.Status.Up}, body.Checks)
+	})
+
+	t.Run("Failed check should not be ready", func(t *testing.T) {
+		h := health.NewHandler(nil)
+		h.Checks["config"] = func(context.Context) error { return nil }
+		h.Checks["migrations"] = func(context.Context) error { return errors.New("err: 1 migrations pending") }
+
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/readyz")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+		helper.ErrorHandler(h.ReadyHandler(c), c)
+
+		var body health.Readiness
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, health.Status.Down, body.Status)
+		assert.Equal(t, health.Status.Down, body.Checks["migrations"])
+		assert.NotContains(t, rec.Body.String(), "pending")
+	})
+
+	t.Run("Draining should not be ready", func(t *testing.T) {
+		h := health.NewHandler(nil)
+		h.Drain()
+
+		rec := openapitest.NewRecorder(t, http.MethodGet, "/readyz")
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+		helper.ErrorHandler(h.ReadyHandler(c), c)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), health.Status.Draining)
+	})
+}
+
+func TestVersionHandler(t *testing.T) {
+	health.Version = "v1.2.3"
+	defer func() { health.Version = "dev" }()
+
+	rec := openapitest.NewRecorder(t, http.MethodGet, "/version")
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/version", nil), rec)
+
+	helper.ErrorHandler(health.NewHandler(nil).VersionHandler(c), c)
+
+	var body health.BuildInfo
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v1.2.3", body.Version)
+	assert.NotEmpty(t, body.GoVersion)
+}
@@ -0,0 +1,15 @@
+package health
+
+import "github.com/labstack/echo/v4"
+
+func (h Handler) RegisterRoutes(e *echo.Echo) {
+	e.GET("/healthz", h.LiveHandler)
+	e.GET("/readyz", h.ReadyHandler)
+	e.GET("/version", h.VersionHandler)
+}
+
+// RegisterAdminRoutes registers the database details, which include errors
+// and pool statistics and are only for admins.
+func (h Handler) RegisterAdminRoutes(e *echo.Group) {
+	e.GET("/health/db", h.DBHandler)
+}
@@ -0,0 +1,50 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BracketLabel returns level in lang when it is a generated label such as
+// "150,001-500,000" or "2,000,001 ขึ้นไป". Labels admins named themselves, and
+// every label when lang is "", are returned as they are.
+func BracketLabel(lang string, level string, min float64, max float64) string {
+	if lang == "" {
+		return level
+	}
+	for _, l := range []string{Lang.English, Lang.Thai} {
+		if level == bracketLabel(l, min, max) {
+			return bracketLabel(lang, min, max)
+		}
+	}
+	return level
+}
+
+func bracketLabel(lang string, min float64, max float64) string {
+	from := 0.0
+	if min > 0 {
+		from = min + 1
+	}
+	if max == 0 {
+		return T(lang, "%s and above", formatNumber(from))
+	}
+	return formatNumber(from) + "-" + formatNumber(max)
+}
+
+// formatNumber formats n with thousands separators, as in 2,000,001.
+func formatNumber(n float64) string {
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if hasFraction {
+		b.WriteString("." + fraction)
+	}
+	return b.String()
+}
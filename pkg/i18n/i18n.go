@@ -0,0 +1,114 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Lang is a supported response language, by its Accept-Language tag.
+var Lang = struct {
+	English string
+	Thai    string
+}{
+	English: "en",
+	Thai:    "th",
+}
+
+// LangKey is the context key holding the language negotiated by the Locale
+// middleware.
+const LangKey = "lang"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalogs maps a language to its messages, keyed by the English message or
+// format string. English needs no catalog.
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	catalogs := map[string]map[string]string{}
+	for _, lang := range []string{Lang.Thai} {
+		b, err := locales.ReadFile("locales/" + lang + ".json")
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic(fmt.Errorf("err: invalid %s catalog: %w", lang, err))
+		}
+		catalogs[lang] = messages
+	}
+	return catalogs
+}
+
+// T returns the message in lang, formatted with args. String args that are
+// messages themselves, such as deduction names, are translated too. Messages
+// missing from the catalog are returned in English.
+func T(lang string, message string, args ...any) string {
+	messages := catalogs[lang]
+	if translated, ok := messages[message]; ok {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+
+	args = append([]any{}, args...)
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			if translated, ok := messages[s]; ok {
+				args[i] = translated
+			}
+		}
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Negotiate picks the supported language the client prefers most from an
+// Accept-Language header. It returns "" when the client did not ask for one.
+func Negotiate(acceptLanguage string) string {
+	type preference struct {
+		lang string
+		q    float64
+	}
+	prefs := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if primary != Lang.English && primary != Lang.Thai {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, preference{primary, q})
+		}
+	}
+	if len(prefs) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	return prefs[0].lang
+}
+
+// FromContext returns the language of the request, negotiating it when the
+// Locale middleware did not run.
+func FromContext(c echo.Context) string {
+	if lang, ok := c.Get(LangKey).(string); ok {
+		return lang
+	}
+	return Negotiate(c.Request().Header.Get("Accept-Language"))
+}
@@ -0,0 +1,74 @@
+package i18n_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/i18n"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                       "",
+		"th":                     i18n.Lang.Thai,
+		"th-TH,th;q=0.9":         i18n.Lang.Thai,
+		"en-US":                  i18n.Lang.English,
+		"fr, th;q=0.5, en;q=0.8": i18n.Lang.English,
+		"en;q=0.1, th":           i18n.Lang.Thai,
+		"fr, de":                 "",
+		"th;q=0, en;q=0.2":       i18n.Lang.English,
+		"*":                      "",
+		"th;q=invalid, en;q=0.5": i18n.Lang.English,
+	} {
+		assert.Equal(t, want, i18n.Negotiate(header), header)
+	}
+}
+
+func TestT(t *testing.T) {
+	t.Run("Thai", func(t *testing.T) {
+		assert.Equal(t, "คำขอไม่ถูกต้อง", i18n.T(i18n.Lang.Thai, "invalid request"))
+		assert.Equal(t, "wht ต้องน้อยกว่าหรือเท่ากับ totalIncome", i18n.T(i18n.Lang.Thai, "%s must be less than or equal to %s", "wht", "totalIncome"))
+		assert.Equal(t, "ค่าลดหย่อนส่วนตัว ต้องอยู่ระหว่าง 10000 ถึง 100000", i18n.T(i18n.Lang.Thai, "%s must be between %0.f and %0.f", "Personal deduction", 10000.0, 100000.0))
+	})
+
+	t.Run("English", func(t *testing.T) {
+		assert.Equal(t, "invalid request", i18n.T(i18n.Lang.English, "invalid request"))
+		assert.Equal(t, "wht must be less than or equal to totalIncome", i18n.T(i18n.Lang.English, "%s must be less than or equal to %s", "wht", "totalIncome"))
+	})
+
+	t.Run("Missing messages should stay in English", func(t *testing.T) {
+		assert.Equal(t, "something new", i18n.T(i18n.Lang.Thai, "something new"))
+	})
+}
+
+func TestBracketLabel(t *testing.T) {
+	t.Run("Generated labels should be translated", func(t *testing.T) {
+		assert.Equal(t, "2,000,001 and above", i18n.BracketLabel(i18n.Lang.English, "2,000,001 ขึ้นไป", 2000000, 0))
+		assert.Equal(t, "2,000,001 ขึ้นไป", i18n.BracketLabel(i18n.Lang.Thai, "2,000,001 and above", 2000000, 0))
+		assert.Equal(t, "150,001-500,000", i18n.BracketLabel(i18n.Lang.Thai, "150,001-500,000", 150000, 500000))
+		assert.Equal(t, "0-150,000", i18n.BracketLabel(i18n.Lang.English, "0-150,000", 0, 150000))
+	})
+
+	t.Run("Named labels should be kept", func(t *testing.T) {
+		assert.Equal(t, "top", i18n.BracketLabel(i18n.Lang.English, "top", 2000000, 0))
+	})
+
+	t.Run("No language should keep the label", func(t *testing.T) {
+		assert.Equal(t, "2,000,001 ขึ้นไป", i18n.BracketLabel("", "2,000,001 ขึ้นไป", 2000000, 0))
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "th")
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	assert.Equal(t, i18n.Lang.Thai, i18n.FromContext(c))
+
+	c.Set(i18n.LangKey, i18n.Lang.English)
+	assert.Equal(t, i18n.Lang.English, i18n.FromContext(c))
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "ktaxes"
+
+var Result = struct {
+	Refund  string
+	Payment string
+	None    string
+}{
+	Refund:  "refund",
+	Payment: "payment",
+	None:    "none",
+}
+
+var CSVRow = struct {
+	Processed string
+	Rejected  string
+}{
+	Processed: "processed",
+	Rejected:  "rejected",
+}
+
+// Registry holds every metric of the service, served by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	Calculations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "calculations_total",
+		Help:      "Tax calculations by the highest bracket reached.",
+	}, []string{"type", "bracket"})
+
+	CalculationResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "calculation_results_total",
+		Help:      "Tax calculations ending in a refund, a payment or neither.",
+	}, []string{"type", "result"})
+
+	CSVRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "csv_rows_total",
+		Help:      "Rows of uploaded CSV files, processed or rejected.",
+	}, []string{"result"})
+
+	ConfigReadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_read_duration_seconds",
+		Help:      "Duration of reads from the config store.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	ConfigChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_changes_total",
+		Help:      "Admin changes to the config store.",
+	}, []string{"operation", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		Calculations,
+		CalculationResults,
+		CSVRows,
+		ConfigReadDuration,
+		ConfigChanges,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+var Handler = echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+// ResultOf returns whether a calculation ends in a refund or a payment.
+func ResultOf(tax float64, refund float64) string {
+	if refund > 0 {
+		return Result.Refund
+	}
+	if tax > 0 {
+		return Result.Payment
+	}
+	return Result.None
+}
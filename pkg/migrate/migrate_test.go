@@ -0,0 +1,234 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jaiieth/assessment-tax/pkg/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+var files = fstest.MapFS{
+	"0002_add_column.up.sql":     {Data: []byte("ALTER TABLE a ADD COLUMN b INT;")},
+	"0002_add_column.down.sql":   {Data: []byte("ALTER TABLE a DROP COLUMN b;")},
+	"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+	"0001_create_table.down.sql": {Data: []byte("DROP TABLE a;")},
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Migrations should be ordered by version", func(t *testing.T) {
+		migrations, err := migrate.Load(files)
+
+		assert.NoError(t, err)
+		assert.Len(t, migrations, 2)
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "create_table", migrations[0].Name)
+		assert.Equal(t, "DROP TABLE a;", migrations[0].Down)
+		assert.Equal(t, int64(2), migrations[1].Version)
+	})
+
+	invalid := map[string]fstest.MapFS{
+		"Missing down file": {"0001_a.up.sql": {Data: []byte("SELECT 1;")}},
+		"Invalid file name": {"create.sql": {Data: []byte("SELECT 1;")}},
+		"Duplicate version": {
+			"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_b.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range invalid {
+		t.Run(name+" should return error", func(t *testing.T) {
+			_, err := migrate.Load(fsys)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func stateRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"version", "checksum", "applied_at"})
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).WithArgs(migrate.LOCK_ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUp(t *testing.T) {
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Pending migrations should be applied in order", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+			WillReturnRows(stateRows().AddRow(1, migrations[0].Checksum(), time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a ADD COLUMN b INT;")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(int64(2), "add_column", migrations[1].Checksum()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		m := &migrate.Migrator{Db: db, Migrations: migrations}
+		applied, err := m.Up()
+
+		assert.NoError(t, err)
+		assert.Len(t, applied, 1)
+		assert.Equal(t, int64(2), applied[0].Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Failed migration should roll back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").WillReturnRows(stateRows())
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id INT);")).WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+
+		m := &migrate.Migrator{Db: db, Migrations: migrations}
+		_, err = m.Up()
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Changed migration should fail checksum verification", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+			WillReturnRows(stateRows().AddRow(1, "edited", time.Now()))
+		mock.ExpectRollback()
+
+		m := &migrate.Migrator{Db: db, Migrations: migrations}
+		_, err = m.Up()
+
+		assert.ErrorIs(t, err, migrate.ErrChecksumMismatch)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown applied migration should fail", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectLock(mock)
+		mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+			WillReturnRows(stateRows().AddRow(3, "newer", time.Now()))
+		mock.ExpectRollback()
+
+		m := &migrate.Migrator{Db: db, Migrations: migrations}
+		_, err = m.Up()
+
+		assert.ErrorIs(t, err, migrate.ErrUnknownMigration)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDown(t *testing.T) {
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectLock(mock)
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(stateRows().
+			AddRow(1, migrations[0].Checksum(), time.Now()).
+			AddRow(2, migrations[1].Checksum(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a DROP COLUMN b;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := &migrate.Migrator{Db: db, Migrations: migrations}
+	reverted, err := m.Down(1)
+
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, "add_column", reverted[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatus(t *testing.T) {
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	appliedAt := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	expectLock(mock)
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(stateRows().AddRow(1, migrations[0].Checksum(), appliedAt))
+	mock.ExpectCommit()
+
+	m := &migrate.Migrator{Db: db, Migrations: migrations}
+	statuses, err := m.Status()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migrate.Status{
+		{Version: 1, Name: "create_table", AppliedAt: &appliedAt},
+		{Version: 2, Name: "add_column"},
+	}, statuses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPending(t *testing.T) {
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(stateRows().AddRow(1, migrations[0].Checksum(), time.Now()))
+
+	m := &migrate.Migrator{Db: db, Migrations: migrations}
+	pending, err := m.Pending(context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, int64(2), pending[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
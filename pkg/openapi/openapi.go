@@ -0,0 +1,57 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Spec is the OpenAPI 3 document of every route, served at /openapi.json.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// DOCS_ASSETS are the swagger-ui-dist files /docs needs. They are embedded in
+// the binary by github.com/swaggo/files/v2, whose version in go.mod pins the
+// Swagger UI release, so the page loads nothing from a CDN.
+var DOCS_ASSETS = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>K-Tax API</title>
+  <link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/docs/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+func SpecHandler(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, Spec)
+}
+
+// DocsHandler serves Swagger UI for the spec.
+func DocsHandler(c echo.Context) error {
+	return c.HTML(http.StatusOK, docsPage)
+}
+
+// DocsAssetHandler serves one of DOCS_ASSETS from the embedded files.
+func DocsAssetHandler(c echo.Context) error {
+	file := c.Param("file")
+	for _, asset := range DOCS_ASSETS {
+		if file == asset {
+			return echo.StaticFileHandler(file, swaggerFiles.FS)(c)
+		}
+	}
+	return helper.NotFound("file not found", nil)
+}
@@ -0,0 +1,123 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type operation struct {
+	Security  []map[string][]string      `json:"security"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+type document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		SecuritySchemes map[string]struct {
+			Type   string `json:"type"`
+			Scheme string `json:"scheme"`
+		} `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+func TestSpecHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = helper.ErrorHandler
+	openapi.RegisterRoutes(e)
+
+	t.Run("Should serve the spec", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+		var doc document
+		err := json.Unmarshal(rec.Body.Bytes(), &doc)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+		assert.True(t, strings.HasPrefix(doc.OpenAPI, "3."))
+	})
+
+	t.Run("Should serve Swagger UI loading the spec", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `url: "/openapi.json"`)
+		assert.NotContains(t, rec.Body.String(), "https://")
+		for _, asset := range openapi.DOCS_ASSETS {
+			assert.Contains(t, rec.Body.String(), `"/docs/`+asset+`"`)
+		}
+	})
+
+	t.Run("Should serve the embedded Swagger UI assets", func(t *testing.T) {
+		for asset, contentType := range map[string]string{"swagger-ui.css": "text/css", "swagger-ui-bundle.js": "text/javascript"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/"+asset, nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code, asset)
+			assert.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), contentType), asset)
+			assert.NotEmpty(t, rec.Body.Bytes(), asset)
+		}
+	})
+
+	t.Run("Should not serve other files", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/index.html", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestSpec(t *testing.T) {
+	var doc document
+	err := json.Unmarshal(openapi.Spec, &doc)
+	assert.NoError(t, err)
+
+	t.Run("Admin endpoints should require Basic Auth or a token", func(t *testing.T) {
+		basic := doc.Components.SecuritySchemes["basicAuth"]
+		assert.Equal(t, "http", basic.Type)
+		assert.Equal(t, "basic", basic.Scheme)
+
+		for path, operations := range doc.Paths {
+			if !strings.HasPrefix(path, "/admin/") || path == "/admin/login" {
+				continue
+			}
+			for method, op := range operations {
+				assert.Contains(t, op.Security, map[string][]string{"basicAuth": {}}, method+" "+path)
+				assert.Contains(t, op.Security, map[string][]string{"bearerAuth": {}}, method+" "+path)
+			}
+		}
+	})
+
+	t.Run("Every operation should document its responses", func(t *testing.T) {
+		for path, operations := range doc.Paths {
+			for method, op := range operations {
+				assert.NotEmpty(t, op.Responses, method+" "+path)
+			}
+		}
+	})
+
+	t.Run("Every reference should resolve", func(t *testing.T) {
+		var raw map[string]interface{}
+		json.Unmarshal(openapi.Spec, &raw)
+
+		for _, m := range regexp.MustCompile(`"\$ref": "#/([^"]+)"`).FindAllStringSubmatch(string(openapi.Spec), -1) {
+			var node interface{} = raw
+			for _, key := range strings.Split(m[1], "/") {
+				parent, _ := node.(map[string]interface{})
+				node = parent[key]
+			}
+			assert.NotNil(t, node, m[1])
+		}
+	})
+}
@@ -0,0 +1,40 @@
+// Package openapitest checks responses recorded in handler tests against the
+// OpenAPI spec.
+package openapitest
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+var validator = sync.OnceValues(func() (*openapi.Validator, error) {
+	return openapi.NewValidator(openapi.Spec)
+})
+
+// NewRecorder returns a recorder whose response must match the operation at
+// method and path of the spec, such as POST /admin/deductions/{type}. The
+// test fails when it ends with a response the spec does not allow. Nothing
+// is checked when nothing was written.
+func NewRecorder(t testing.TB, method string, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	v, err := validator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	t.Cleanup(func() {
+		contentType := rec.Header().Get(echo.HeaderContentType)
+		if rec.Body.Len() == 0 && contentType == "" {
+			return
+		}
+		if err := v.ValidateResponse(method, path, rec.Code, contentType, rec.Body.Bytes()); err != nil {
+			t.Error(err)
+		}
+	})
+	return rec
+}
@@ -0,0 +1,56 @@
+package openapitest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/openapi/openapitest"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT keeps the cleanups and errors of a test instead of failing it.
+type recordingT struct {
+	testing.TB
+	cleanups []func()
+	errors   []interface{}
+}
+
+func (t *recordingT) Helper()                   {}
+func (t *recordingT) Cleanup(f func())          { t.cleanups = append(t.cleanups, f) }
+func (t *recordingT) Error(args ...interface{}) { t.errors = append(t.errors, args...) }
+
+func (t *recordingT) finish() {
+	for _, f := range t.cleanups {
+		f()
+	}
+}
+
+func TestNewRecorder(t *testing.T) {
+	record := func(status int, body string) []interface{} {
+		rt := &recordingT{TB: t}
+		rec := openapitest.NewRecorder(rt, http.MethodGet, "/admin/deductions")
+		if body != "" {
+			rec.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec.WriteHeader(status)
+			rec.WriteString(body)
+		}
+		rt.finish()
+		return rt.errors
+	}
+
+	t.Run("Response matching the spec should pass", func(t *testing.T) {
+		assert.Empty(t, record(http.StatusOK, `[{"type": "personal", "amount": 60000, "min": 10000, "max": 100000}]`))
+	})
+
+	t.Run("Response breaking the spec should fail the test", func(t *testing.T) {
+		errors := record(http.StatusOK, `{"personalDeduction": 60000}`)
+
+		assert.Len(t, errors, 1)
+		assert.Contains(t, errors[0].(error).Error(), "body must be of type array")
+	})
+
+	t.Run("Nothing written should not be checked", func(t *testing.T) {
+		assert.Empty(t, record(0, ""))
+	})
+}
@@ -0,0 +1,9 @@
+package openapi
+
+import "github.com/labstack/echo/v4"
+
+func RegisterRoutes(e *echo.Echo) {
+	e.GET("/openapi.json", SpecHandler)
+	e.GET("/docs", DocsHandler)
+	e.GET("/docs/:file", DocsAssetHandler)
+}
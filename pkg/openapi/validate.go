@@ -0,0 +1,358 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/labstack/echo/v4"
+)
+
+// Schema is the part of JSON Schema the validator supports: $ref, type,
+// format (only date-time is checked), nullable, required, properties,
+// additionalProperties, items, enum, minimum and maximum. NewValidator
+// rejects a spec whose schemas use any other keyword, such as oneOf, allOf,
+// minLength, pattern or minItems, rather than letting it pass unchecked.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// SCHEMA_KEYWORDS are the keywords Schema understands and ANNOTATIONS the
+// ones that do not constrain a value, which it ignores.
+var (
+	SCHEMA_KEYWORDS = []string{
+		"$ref", "type", "format", "nullable", "required", "properties",
+		"additionalProperties", "items", "enum", "minimum", "maximum",
+	}
+	ANNOTATIONS = []string{
+		"title", "description", "example", "examples", "default",
+		"deprecated", "readOnly", "writeOnly", "externalDocs",
+	}
+)
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return fmt.Errorf("schema must be an object: %w", err)
+	}
+	for k := range keywords {
+		if !slices.Contains(SCHEMA_KEYWORDS, k) && !slices.Contains(ANNOTATIONS, k) && !strings.HasPrefix(k, "x-") {
+			return fmt.Errorf("schema keyword %q is not supported", k)
+		}
+	}
+	type schema Schema
+	return json.Unmarshal(data, (*schema)(s))
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]response `json:"responses"`
+}
+
+type route struct {
+	method    string
+	segments  []string
+	operation operation
+}
+
+// Validator checks requests and responses against a spec.
+type Validator struct {
+	schemas   map[string]*Schema
+	responses map[string]response
+	routes    []route
+}
+
+func NewValidator(spec []byte) (*Validator, error) {
+	var doc struct {
+		Paths      map[string]map[string]operation `json:"paths"`
+		Components struct {
+			Schemas   map[string]*Schema  `json:"schemas"`
+			Responses map[string]response `json:"responses"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	v := &Validator{schemas: doc.Components.Schemas, responses: doc.Components.Responses}
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			v.routes = append(v.routes, route{strings.ToUpper(method), strings.Split(path, "/"), op})
+		}
+	}
+	// Literal segments win over parameters, so /tax/calculations/upload-csv
+	// is not taken for /tax/calculations/{id}.
+	sort.Slice(v.routes, func(i, j int) bool {
+		return literals(v.routes[i].segments) > literals(v.routes[j].segments)
+	})
+	return v, nil
+}
+
+func literals(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if !strings.HasPrefix(s, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// find returns the operation serving method and path, which is either a
+// request path or a path of the spec.
+func (v *Validator) find(method string, path string) (operation, bool) {
+	segments := strings.Split(path, "/")
+	for _, r := range v.routes {
+		if r.method == method && matches(r.segments, segments) {
+			return r.operation, true
+		}
+	}
+	return operation{}, false
+}
+
+func matches(template []string, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, s := range template {
+		if strings.HasPrefix(s, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateRequest checks the JSON body of r against the schema of its
+// operation and puts the body back for the handler. Bodies of other media
+// types and paths missing from the spec are left to the handler. Malformed
+// JSON and violations are returned as a helper.ValidationError.
+func (v *Validator) ValidateRequest(r *http.Request) error {
+	op, ok := v.find(r.Method, r.URL.Path)
+	if !ok || op.RequestBody == nil || r.Body == nil {
+		return nil
+	}
+	media, _, _ := mime.ParseMediaType(r.Header.Get(echo.HeaderContentType))
+	content, ok := op.RequestBody.Content[media]
+	if !ok || content.Schema == nil || !isJSON(media) {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return helper.ValidationError{helper.NewFieldError("", "json", nil, "%s must be valid JSON", "body")}
+	}
+	if errs := v.validate(content.Schema, value, "", false); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateResponse checks that status is documented for the operation and
+// that the body matches its schema. Unlike requests, objects in responses
+// may only have the properties the spec lists.
+func (v *Validator) ValidateResponse(method string, path string, status int, contentType string, body []byte) error {
+	op, ok := v.find(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s is not in the spec", method, path)
+	}
+	res, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		res, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not in the spec", method, path, status)
+	}
+	if res.Ref != "" {
+		res = v.responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+	}
+	if len(res.Content) == 0 {
+		return nil
+	}
+
+	media, _, _ := mime.ParseMediaType(contentType)
+	content, ok := res.Content[media]
+	if !ok {
+		return fmt.Errorf("%s %s: %d response of type %q is not in the spec", method, path, status, contentType)
+	}
+	if content.Schema == nil || !isJSON(media) {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s %s: %d response is not JSON: %w", method, path, status, err)
+	}
+	if errs := v.validate(content.Schema, value, "", true); len(errs) > 0 {
+		messages := []string{}
+		for _, f := range errs {
+			messages = append(messages, f.Pointer+": "+f.Message)
+		}
+		return fmt.Errorf("%s %s: %d response does not match the spec: %s", method, path, status, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+func isJSON(media string) bool {
+	return media == "application/json" || strings.HasSuffix(media, "+json")
+}
+
+func (v *Validator) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = v.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (v *Validator) validate(s *Schema, value interface{}, pointer string, strict bool) helper.ValidationError {
+	s = v.resolve(s)
+	if s == nil {
+		return nil
+	}
+	name := field(pointer)
+
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return helper.ValidationError{helper.NewFieldError(pointer, "type", s.Type, "%s must be of type %s", name, s.Type)}
+	}
+	if !hasType(s.Type, value) {
+		return helper.ValidationError{helper.NewFieldError(pointer, "type", s.Type, "%s must be of type %s", name, s.Type)}
+	}
+	if len(s.Enum) > 0 && !oneOf(s.Enum, value) {
+		options := []string{}
+		for _, e := range s.Enum {
+			options = append(options, fmt.Sprint(e))
+		}
+		return helper.ValidationError{helper.NewFieldError(pointer, "oneof", options, "%s must be one of %s", name, strings.Join(options, ", "))}
+	}
+
+	errs := helper.ValidationError{}
+	switch value := value.(type) {
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			errs = append(errs, helper.NewFieldError(pointer, "gte", *s.Minimum, "%s must be greater than or equal to %s", name, number(*s.Minimum)))
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			errs = append(errs, helper.NewFieldError(pointer, "lte", *s.Maximum, "%s must be less than or equal to %s", name, number(*s.Maximum)))
+		}
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				errs = append(errs, helper.NewFieldError(pointer, "format", s.Format, "%s is invalid", name))
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			errs = append(errs, v.validate(s.Items, item, pointer+"/"+strconv.Itoa(i), strict)...)
+		}
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := value[r]; !ok {
+				errs = append(errs, helper.NewFieldError(pointer+"/"+escape(r), "required", nil, "%s is required", r))
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := pointer + "/" + escape(k)
+			switch property, ok := s.Properties[k]; {
+			case ok:
+				errs = append(errs, v.validate(property, value[k], p, strict)...)
+			case s.AdditionalProperties != nil:
+				errs = append(errs, v.validate(s.AdditionalProperties, value[k], p, strict)...)
+			case strict && len(s.Properties) > 0:
+				errs = append(errs, helper.NewFieldError(p, "unknown", nil, "%s is not in the spec", k))
+			}
+		}
+	}
+	return errs
+}
+
+func hasType(t string, value interface{}) bool {
+	switch value := value.(type) {
+	case string:
+		return t == "" || t == "string"
+	case float64:
+		return t == "" || t == "number" || (t == "integer" && value == math.Trunc(value))
+	case bool:
+		return t == "" || t == "boolean"
+	case []interface{}:
+		return t == "" || t == "array"
+	case map[string]interface{}:
+		return t == "" || t == "object"
+	}
+	return false
+}
+
+func oneOf(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// field is the name of the value at pointer, for messages.
+func field(pointer string) string {
+	if pointer == "" {
+		return "body"
+	}
+	name := pointer[strings.LastIndex(pointer, "/")+1:]
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+}
+
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,153 @@
+package openapi_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/helper"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequest(t *testing.T) {
+	v, err := openapi.NewValidator(openapi.Spec)
+	assert.NoError(t, err)
+
+	validate := func(method string, target string, contentType string, body string) error {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		return v.ValidateRequest(req)
+	}
+
+	t.Run("Valid body should pass", func(t *testing.T) {
+		err := validate(http.MethodPost, "/tax/calculations", echo.MIMEApplicationJSON, `{
+			"totalIncome": 500000, "wht": 0, "date": "2024-06-01T00:00:00+07:00",
+			"allowances": [{"allowanceType": "k-receipt", "amount": 200000}]
+		}`)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Body should be kept for the handler", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/tax/calculations", strings.NewReader(`{"totalIncome": 500000}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+
+		assert.NoError(t, v.ValidateRequest(req))
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(t, `{"totalIncome": 500000}`, string(body))
+	})
+
+	t.Run("Violations should be reported by JSON pointer", func(t *testing.T) {
+		err := validate(http.MethodPost, "/tax/calculations", echo.MIMEApplicationJSON, `{
+			"wht": "0", "configVersion": 1.5,
+			"allowances": [{"allowanceType": "lottery", "amount": -1}]
+		}`)
+
+		assert.Equal(t, helper.ValidationError{
+			helper.NewFieldError("/totalIncome", "required", nil, "%s is required", "totalIncome"),
+			helper.NewFieldError("/allowances/0/allowanceType", "oneof", []string{"donation", "k-receipt"}, "%s must be one of %s", "allowanceType", "donation, k-receipt"),
+			helper.NewFieldError("/allowances/0/amount", "gte", 0.0, "%s must be greater than or equal to %s", "amount", "0"),
+			helper.NewFieldError("/configVersion", "type", "integer", "%s must be of type %s", "configVersion", "integer"),
+			helper.NewFieldError("/wht", "type", "number", "%s must be of type %s", "wht", "number"),
+		}, err)
+	})
+
+	t.Run("Path parameters should match any value", func(t *testing.T) {
+		err := validate(http.MethodPost, "/admin/deductions/personal", echo.MIMEApplicationJSON, `{}`)
+
+		assert.IsType(t, helper.ValidationError{}, err)
+	})
+
+	t.Run("Malformed JSON should fail", func(t *testing.T) {
+		err := validate(http.MethodPost, "/tax/calculations", echo.MIMEApplicationJSON, `{invalid`)
+
+		assert.Equal(t, helper.ValidationError{
+			helper.NewFieldError("", "json", nil, "%s must be valid JSON", "body"),
+		}, err)
+	})
+
+	t.Run("Bodies the spec cannot check should be left to the handler", func(t *testing.T) {
+		assert.NoError(t, validate(http.MethodPost, "/tax/calculations/upload-csv", echo.MIMEMultipartForm, `--boundary`))
+		assert.NoError(t, validate(http.MethodPost, "/unknown", echo.MIMEApplicationJSON, `{}`))
+	})
+}
+
+func TestNewValidator(t *testing.T) {
+	spec := func(schema string) []byte {
+		return []byte(`{"paths": {}, "components": {"schemas": {"Body": ` + schema + `}}}`)
+	}
+
+	t.Run("Supported keywords and annotations should be accepted", func(t *testing.T) {
+		_, err := openapi.NewValidator(spec(`{
+			"type": "object", "required": ["amount"], "description": "Body", "x-internal": true,
+			"properties": {"amount": {"type": "number", "minimum": 0, "maximum": 100, "example": 1}}
+		}`))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unsupported keywords should fail", func(t *testing.T) {
+		for _, schema := range []string{
+			`{"oneOf": [{"type": "string"}, {"type": "number"}]}`,
+			`{"allOf": [{"$ref": "#/components/schemas/Other"}]}`,
+			`{"type": "object", "properties": {"name": {"type": "string", "minLength": 1}}}`,
+			`{"type": "string", "pattern": "^[a-z]+$"}`,
+			`{"type": "array", "items": {"type": "string"}, "minItems": 1}`,
+		} {
+			_, err := openapi.NewValidator(spec(schema))
+
+			assert.ErrorContains(t, err, "is not supported", schema)
+		}
+	})
+}
+
+func TestValidateResponse(t *testing.T) {
+	v, err := openapi.NewValidator(openapi.Spec)
+	assert.NoError(t, err)
+
+	t.Run("Documented response should pass", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodPost, "/tax/calculations", http.StatusOK, echo.MIMEApplicationJSON,
+			[]byte(`{"tax": 29000, "taxLevel": [{"level": "0-150,000", "tax": 0}], "configVersion": 1}`))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Literal paths should win over parameters", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodPost, "/tax/calculations/upload-csv", http.StatusOK, echo.MIMEApplicationJSON,
+			[]byte(`{"taxes": [{"totalIncome": 500000, "tax": 29000}], "configVersion": 1}`))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Shared responses should be resolved", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodGet, "/admin/config", http.StatusUnauthorized, echo.MIMEApplicationJSON,
+			[]byte(`{"message": "unauthorized"}`))
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Properties missing from the spec should fail", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodPost, "/tax/calculations", http.StatusOK, echo.MIMEApplicationJSON,
+			[]byte(`{"tax": 29000, "configVersion": 1, "surcharge": 100}`))
+
+		assert.EqualError(t, err, "POST /tax/calculations: 200 response does not match the spec: /surcharge: surcharge is not in the spec")
+	})
+
+	t.Run("Undocumented status should fail", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodGet, "/admin/deductions", http.StatusConflict, echo.MIMEApplicationJSON,
+			[]byte(`{"message": "conflict"}`))
+
+		assert.EqualError(t, err, "GET /admin/deductions: status 409 is not in the spec")
+	})
+
+	t.Run("Undocumented content type should fail", func(t *testing.T) {
+		err := v.ValidateResponse(http.MethodPost, "/tax/calculations", http.StatusBadRequest, echo.MIMEApplicationJSON,
+			[]byte(`{"message": "invalid request"}`))
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,47 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("None should not export", func(t *testing.T) {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Exporter.None, "dev")
+
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("Unknown exporter should return error", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), "zipkin", "dev")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	var err error
+	tracing.End(span, &err)
+
+	_, span = tracer.Start(context.Background(), "failed")
+	err = errors.New("connection refused")
+	tracing.End(span, &err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "connection refused", spans[1].Status().Description)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/jaiieth/assessment-tax/pkg/apikey"
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/jaiieth/assessment-tax/pkg/calculator"
+	"github.com/jaiieth/assessment-tax/pkg/config"
+	"github.com/jaiieth/assessment-tax/pkg/health"
+	"github.com/jaiieth/assessment-tax/pkg/metrics"
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+// routes holds the handlers and middleware behind every route, so the routes
+// can be registered without starting the server.
+type routes struct {
+	calculator calculator.Handler
+	health     health.Handler
+	auth       auth.Handler
+	config     config.Handler
+	apiKeys    apikey.Handler
+	// apiKey guards the calculations, adminAuth everything under /admin.
+	apiKey    echo.MiddlewareFunc
+	adminAuth echo.MiddlewareFunc
+	// validate checks the API routes against the OpenAPI spec, after the
+	// client has been let in.
+	validate echo.MiddlewareFunc
+}
+
+func (r routes) register(e *echo.Echo) {
+	r.calculator.RegisterRoutes(e, r.apiKey, r.validate)
+	r.health.RegisterRoutes(e)
+	e.GET("/metrics", metrics.Handler)
+	openapi.RegisterRoutes(e)
+	r.auth.RegisterRoutes(e, r.validate)
+
+	admin := e.Group("/admin", r.adminAuth, r.validate)
+	r.calculator.RegisterAdminRoutes(admin)
+	r.health.RegisterAdminRoutes(admin)
+	r.config.RegisterRoutes(admin)
+	r.apiKeys.RegisterRoutes(admin)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jaiieth/assessment-tax/pkg/openapi"
+	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+var pathParam = regexp.MustCompile(`:([^/]+)`)
+
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	pass := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	e := echo.New()
+	routes{apiKey: pass, adminAuth: pass, validate: pass}.register(e)
+
+	registered := []string{}
+	for _, r := range e.Routes() {
+		// Groups with middleware add catch-all routes for their 404s.
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		registered = append(registered, r.Method+" "+pathParam.ReplaceAllString(r.Path, "{$1}"))
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err := json.Unmarshal(openapi.Spec, &spec)
+	assert.NoError(t, err)
+
+	documented := []string{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, documented, registered)
+}
+
+func TestSensitiveRoutesRequireAdmin(t *testing.T) {
+	pass := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	deny := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error { return echo.ErrUnauthorized }
+	}
+	e := echo.New()
+	routes{apiKey: pass, adminAuth: deny, validate: pass}.register(e)
+
+	for _, target := range []string{"/admin/calculations", "/admin/calculations/abc", "/admin/health/db"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, target)
+	}
+
+	// History holds taxpayer data, so it is served under /admin instead of
+	// the /tax/calculations/{id} first requested, and the DB details with it.
+	for _, target := range []string{"/tax/calculations/abc", "/health/db"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, target)
+	}
+}
+
+// HANDLER_STATUSES are what each handler returns besides a 500 from an
+// unexpected error, for handlers that return more than 200. What the
+// middleware in front of a route adds is found by
+// TestRoutesDocumentTheirStatuses itself.
+var HANDLER_STATUSES = map[string][]int{
+	"POST /tax/calculations":               {http.StatusOK, http.StatusBadRequest},
+	"POST /tax/calculations/upload-csv":    {http.StatusOK, http.StatusBadRequest, http.StatusTooManyRequests},
+	"POST /admin/login":                    {http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
+	"GET /admin/calculations":              {http.StatusOK, http.StatusBadRequest, http.StatusNotFound},
+	"GET /admin/calculations/{id}":         {http.StatusOK, http.StatusNotFound},
+	"GET /admin/health/db":                 {http.StatusOK, http.StatusNotFound, http.StatusServiceUnavailable},
+	"PUT /admin/config":                    {http.StatusOK, http.StatusBadRequest},
+	"PATCH /admin/config":                  {http.StatusOK, http.StatusBadRequest},
+	"GET /admin/config/versions/{version}": {http.StatusOK, http.StatusBadRequest, http.StatusNotFound},
+	"GET /admin/config/schedule":           {http.StatusOK, http.StatusBadRequest},
+	"POST /admin/config/schedule":          {http.StatusCreated, http.StatusBadRequest},
+	"DELETE /admin/config/schedule/{id}":   {http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	"POST /admin/deductions/{type}":        {http.StatusOK, http.StatusCreated, http.StatusBadRequest, http.StatusNotFound},
+	"PUT /admin/limits":                    {http.StatusOK, http.StatusBadRequest},
+	"GET /admin/audit":                     {http.StatusOK, http.StatusBadRequest},
+	"POST /admin/api-keys":                 {http.StatusCreated, http.StatusBadRequest},
+	"DELETE /admin/api-keys/{id}":          {http.StatusOK, http.StatusBadRequest, http.StatusNotFound},
+	"GET /readyz":                          {http.StatusOK, http.StatusServiceUnavailable},
+	"GET /docs/{file}":                     {http.StatusOK, http.StatusNotFound},
+}
+
+func TestRoutesDocumentTheirStatuses(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			RequestBody json.RawMessage            `json:"requestBody"`
+			Responses   map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+	}
+	err := json.Unmarshal(openapi.Spec, &spec)
+	assert.NoError(t, err)
+
+	// guarded returns the routes behind the middleware that newRoutes puts
+	// in place of pass, found by having it answer with a status no handler
+	// uses.
+	guarded := func(newRoutes func(pass, deny echo.MiddlewareFunc) routes) map[string]bool {
+		pass := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+		deny := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error { return c.NoContent(http.StatusTeapot) }
+		}
+		e := echo.New()
+		// Handlers without their dependencies may panic once reached.
+		e.Use(echoMiddleware.RecoverWithConfig(echoMiddleware.RecoverConfig{DisablePrintStack: true}))
+		newRoutes(pass, deny).register(e)
+
+		found := map[string]bool{}
+		for _, r := range e.Routes() {
+			if r.Method == echo.RouteNotFound {
+				continue
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(r.Method, pathParam.ReplaceAllString(r.Path, "1"), nil))
+			found[r.Method+" "+pathParam.ReplaceAllString(r.Path, "{$1}")] = rec.Code == http.StatusTeapot
+		}
+		return found
+	}
+	apiKey := guarded(func(pass, deny echo.MiddlewareFunc) routes {
+		return routes{apiKey: deny, adminAuth: pass, validate: pass}
+	})
+	adminAuth := guarded(func(pass, deny echo.MiddlewareFunc) routes {
+		return routes{apiKey: pass, adminAuth: deny, validate: pass}
+	})
+	validate := guarded(func(pass, deny echo.MiddlewareFunc) routes {
+		return routes{apiKey: pass, adminAuth: pass, validate: deny}
+	})
+
+	assert.True(t, apiKey["POST /tax/calculations"])
+	assert.True(t, adminAuth["GET /admin/config"])
+	assert.True(t, validate["POST /admin/login"])
+	assert.False(t, adminAuth["POST /admin/login"])
+
+	for route := range HANDLER_STATUSES {
+		_, ok := apiKey[route]
+		assert.True(t, ok, "%s is not registered", route)
+	}
+
+	for route := range apiKey {
+		statuses, ok := HANDLER_STATUSES[route]
+		if !ok {
+			statuses = []int{http.StatusOK}
+		}
+		statuses = append(statuses, http.StatusInternalServerError)
+		if apiKey[route] {
+			statuses = append(statuses, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+		if adminAuth[route] {
+			statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests)
+		}
+
+		method, path, _ := strings.Cut(route, " ")
+		operation := spec.Paths[path][strings.ToLower(method)]
+		// The validator only checks request bodies.
+		if validate[route] && operation.RequestBody != nil {
+			statuses = append(statuses, http.StatusBadRequest)
+		}
+
+		for _, status := range statuses {
+			assert.Contains(t, operation.Responses, strconv.Itoa(status), route)
+		}
+	}
+}
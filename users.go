@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jaiieth/assessment-tax/pkg/auth"
+	"github.com/jaiieth/assessment-tax/pkg/config"
+)
+
+const usersUsage = "usage: users add <username> <viewer|editor> (password is read from stdin)"
+
+// runUsers runs the users subcommand, which adds admin users to Postgres.
+func runUsers(args []string, stdin io.Reader) error {
+	if len(args) != 3 || args[0] != "add" {
+		return errors.New(usersUsage)
+	}
+
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	u, err := auth.NewUser(args[1], strings.TrimRight(password, "\r\n"), args[2])
+	if err != nil {
+		return err
+	}
+
+	db, err := config.Connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err = auth.NewUserStore(db).CreateUser(context.Background(), u)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added %s (%s)\n", u.Username, u.Role)
+	return nil
+}